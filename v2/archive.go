@@ -0,0 +1,323 @@
+package toolkit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrUnsafeArchiveEntry is returned for entries escaping the target directory, links and special files
+	ErrUnsafeArchiveEntry = errors.New("archive contains an unsafe entry")
+	// ErrArchiveLimit is returned when an archive exceeds one of its ArchiveLimits
+	ErrArchiveLimit = errors.New("archive exceeds extraction limits")
+	// ErrUnsupportedArchive is returned when the file is not a zip, tar or tar.gz archive
+	ErrUnsupportedArchive = errors.New("unsupported archive format")
+)
+
+// ArchiveLimits guards ExtractArchive against zip bombs, zero values use the defaults
+type ArchiveLimits struct {
+	// MaxEntries is the maximum number of files and directories, defaults to 1000
+	MaxEntries int
+	// MaxTotalSize is the maximum number of uncompressed bytes, defaults to MaxFileSize or 1GB
+	MaxTotalSize int64
+	// MaxRatio is the maximum uncompressed to compressed ratio, defaults to 100
+	MaxRatio int64
+}
+
+func (t *Tools) archiveLimits(limits []ArchiveLimits) ArchiveLimits {
+	var l ArchiveLimits
+	if len(limits) > 0 {
+		l = limits[0]
+	}
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = 1000
+	}
+	if l.MaxTotalSize <= 0 {
+		l.MaxTotalSize = t.MaxFileSize
+		if l.MaxTotalSize <= 0 {
+			l.MaxTotalSize = 1024 * 1024 * 1024
+		}
+	}
+	if l.MaxRatio <= 0 {
+		l.MaxRatio = 100
+	}
+	return l
+}
+
+// archiveEntry is the part of a zip or tar header the extractor cares about
+type archiveEntry struct {
+	name           string
+	dir            bool
+	regular        bool
+	compressedSize int64
+	open           func() (io.ReadCloser, error)
+}
+
+// extraction tracks what has been written so far so limits apply across entries
+type extraction struct {
+	t          *Tools
+	targetDir  string
+	limits     ArchiveLimits
+	compressed func() int64
+	entries    int
+	total      int64
+	files      []*UploadedFile
+	created    []string
+	// createdDirs are the directories made by the extraction, parents before their children
+	createdDirs []string
+}
+
+// ExtractArchive unpacks a zip, tar or tar.gz file into targetDir and reports every extracted
+// file like UploadFiles does, NewFileName being the slash separated path below targetDir.
+// Entries escaping targetDir, links and device files are rejected, AllowedFileTypes applies to
+// every extracted file and limits protect against archive bombs. On error the files extracted
+// so far are removed again.
+func (t *Tools) ExtractArchive(archivePath, targetDir string, limits ...ArchiveLimits) ([]*UploadedFile, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 512)
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	magic = magic[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	x := &extraction{t: t, targetDir: targetDir, limits: t.archiveLimits(limits)}
+	if err := x.createDir(targetDir); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		err = x.extractZip(f, stat.Size())
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		counter := &countingReader{r: bufio.NewReader(f)}
+		x.compressed = func() int64 { return counter.n }
+		gz, gzErr := gzip.NewReader(counter)
+		if gzErr != nil {
+			return nil, gzErr
+		}
+		defer gz.Close()
+		err = x.extractTar(gz)
+	case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+		err = x.extractTar(f)
+	default:
+		return nil, ErrUnsupportedArchive
+	}
+
+	if err != nil {
+		x.rollback()
+		return nil, err
+	}
+	return x.files, nil
+}
+
+func (x *extraction) extractZip(f *os.File, size int64) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		zf := zf
+		mode := zf.Mode()
+		entry := archiveEntry{
+			name:           zf.Name,
+			dir:            mode.IsDir(),
+			regular:        mode.IsRegular(),
+			compressedSize: int64(zf.CompressedSize64),
+			open:           zf.Open,
+		}
+		// declared sizes are checked up front, the real sizes again while copying
+		if zf.UncompressedSize64 > uint64(x.limits.MaxTotalSize) {
+			return fmt.Errorf("%w: %s is too big", ErrArchiveLimit, zf.Name)
+		}
+		if err := x.extract(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extraction) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// git archive and GNU tar start with global pax metadata, it is not a file
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		entry := archiveEntry{
+			name:    hdr.Name,
+			dir:     hdr.Typeflag == tar.TypeDir,
+			regular: hdr.Typeflag == tar.TypeReg,
+			// a plain tar stores entries uncompressed, tar.gz checks the whole stream instead
+			compressedSize: hdr.Size,
+			open:           func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}
+		if err := x.extract(entry); err != nil {
+			return err
+		}
+	}
+}
+
+func (x *extraction) extract(entry archiveEntry) error {
+	x.entries++
+	if x.entries > x.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, x.limits.MaxEntries)
+	}
+
+	name := strings.TrimSuffix(path.Clean(strings.ReplaceAll(entry.name, `\`, "/")), "/")
+	if strings.HasPrefix(entry.name, "/") || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("%w: %s escapes the target directory", ErrUnsafeArchiveEntry, entry.name)
+	}
+	if !entry.dir && !entry.regular {
+		return fmt.Errorf("%w: %s is not a regular file", ErrUnsafeArchiveEntry, entry.name)
+	}
+
+	dest := filepath.Join(x.targetDir, filepath.FromSlash(name))
+	if entry.dir {
+		return x.createDir(dest)
+	}
+	if err := x.createDir(filepath.Dir(dest)); err != nil {
+		return err
+	}
+
+	in, err := entry.open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// check to see if the file type is permitted
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(in, buff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	if !x.t.isAllowedFileType(http.DetectContentType(buff[:n])) {
+		return fmt.Errorf("file type is not allowed: %s", entry.name)
+	}
+
+	// never overwrite or follow anything that already exists
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	x.created = append(x.created, dest)
+	defer out.Close()
+
+	guard := &ratioGuard{x: x, entry: entry, r: io.MultiReader(bytes.NewReader(buff[:n]), in)}
+	written, err := io.Copy(out, guard)
+	if err != nil {
+		return err
+	}
+
+	x.files = append(x.files, &UploadedFile{
+		NewFileName:      name,
+		OriginalFileName: entry.name,
+		FileSize:         written,
+	})
+	return nil
+}
+
+// ratioGuard enforces the size and compression ratio limits while an entry is being copied,
+// so a bomb is stopped long before it is fully written. The ratio is compared per entry for
+// zip files and over the whole stream for tar.gz, small amounts are ignored since even
+// ordinary text compresses very well.
+type ratioGuard struct {
+	x       *extraction
+	entry   archiveEntry
+	r       io.Reader
+	written int64
+}
+
+func (g *ratioGuard) Read(p []byte) (int, error) {
+	const minSize = 1024 * 1024
+
+	n, err := g.r.Read(p)
+	g.written += int64(n)
+	g.x.total += int64(n)
+
+	if g.x.total > g.x.limits.MaxTotalSize {
+		return n, fmt.Errorf("%w: more than %d bytes uncompressed", ErrArchiveLimit, g.x.limits.MaxTotalSize)
+	}
+
+	uncompressed, compressed := g.written, g.entry.compressedSize
+	if g.x.compressed != nil {
+		uncompressed, compressed = g.x.total, g.x.compressed()
+	}
+	if uncompressed >= minSize && (compressed <= 0 || uncompressed/compressed > g.x.limits.MaxRatio) {
+		return n, fmt.Errorf("%w: compression ratio of %s exceeds %d", ErrArchiveLimit, g.entry.name, g.x.limits.MaxRatio)
+	}
+	return n, err
+}
+
+// createDir creates dir and its missing parents, remembering them for rollback
+func (x *extraction) createDir(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := x.t.CreateDirIfNotExists(dir); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		x.createdDirs = append(x.createdDirs, missing[i])
+	}
+	return nil
+}
+
+// rollback removes every file and directory created by a failed extraction, directories
+// deepest first once their files are gone
+func (x *extraction) rollback() {
+	for i := len(x.created) - 1; i >= 0; i-- {
+		_ = os.Remove(x.created[i])
+	}
+	for i := len(x.createdDirs) - 1; i >= 0; i-- {
+		_ = os.Remove(x.createdDirs[i])
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,208 @@
+package toolkit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type archiveFile struct {
+	name      string
+	body      []byte
+	symlink   bool
+	isDir     bool
+	noDeflate bool
+	// paxGlobal writes a pax global header, as git archive does
+	paxGlobal bool
+}
+
+func writeZip(t *testing.T, dir string, files []archiveFile) string {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+		if f.noDeflate {
+			hdr.Method = zip.Store
+		}
+		switch {
+		case f.symlink:
+			hdr.SetMode(os.ModeSymlink | 0777)
+		case f.isDir:
+			hdr.SetMode(os.ModeDir | 0755)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(f.body)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "archive.zip")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func writeTarGz(t *testing.T, dir string, files []archiveFile) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}
+		switch {
+		case f.symlink:
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, "/etc/passwd", 0
+		case f.isDir:
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		case f.paxGlobal:
+			hdr = &tar.Header{Name: f.name, Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "b8a4b15"}}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = tw.Write(f.body)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "archive.tar.gz")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestTools_ExtractArchive(t *testing.T) {
+	png, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []archiveFile{
+		{name: "docs/", isDir: true},
+		{name: "docs/readme.txt", body: []byte("hello")},
+		{name: "images/img.png", body: png},
+	}
+
+	for name, write := range map[string]func(*testing.T, string, []archiveFile) string{"zip": writeZip, "tar.gz": writeTarGz} {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "out")
+
+		var testTools Tools
+		extracted, err := testTools.ExtractArchive(write(t, dir, files), target)
+		if err != nil {
+			t.Fatalf("%s: error extracting archive: %v", name, err)
+		}
+		if len(extracted) != 2 {
+			t.Fatalf("%s: expected 2 files, got %d", name, len(extracted))
+		}
+		if extracted[1].NewFileName != "images/img.png" || extracted[1].FileSize != int64(len(png)) {
+			t.Errorf("%s: extracted file not as expected: %+v", name, extracted[1])
+		}
+		stored, err := os.ReadFile(filepath.Join(target, "images", "img.png"))
+		if err != nil || !bytes.Equal(stored, png) {
+			t.Errorf("%s: extracted content does not match: %v", name, err)
+		}
+	}
+}
+
+var extractArchiveTests = []struct {
+	name     string
+	files    []archiveFile
+	limits   ArchiveLimits
+	expected error
+}{
+	{name: "zip slip", files: []archiveFile{{name: "../evil.txt", body: []byte("x")}}, expected: ErrUnsafeArchiveEntry},
+	{name: "nested zip slip", files: []archiveFile{{name: "a/../../evil.txt", body: []byte("x")}}, expected: ErrUnsafeArchiveEntry},
+	{name: "absolute path", files: []archiveFile{{name: "/tmp/evil.txt", body: []byte("x")}}, expected: ErrUnsafeArchiveEntry},
+	{name: "symlink", files: []archiveFile{{name: "link", symlink: true, body: []byte("/etc/passwd")}}, expected: ErrUnsafeArchiveEntry},
+	{name: "nested rollback", files: []archiveFile{{name: "a/b/c.txt", body: []byte("c")}, {name: "a/d/../../../evil.txt", body: []byte("x")}}, expected: ErrUnsafeArchiveEntry},
+	{name: "too many entries", files: []archiveFile{{name: "a.txt", body: []byte("a")}, {name: "b.txt", body: []byte("b")}}, limits: ArchiveLimits{MaxEntries: 1}, expected: ErrArchiveLimit},
+	{name: "too big", files: []archiveFile{{name: "a.txt", body: bytes.Repeat([]byte("a"), 100), noDeflate: true}}, limits: ArchiveLimits{MaxTotalSize: 50}, expected: ErrArchiveLimit},
+	{name: "bomb", files: []archiveFile{{name: "zeros.txt", body: make([]byte, 4*1024*1024)}}, expected: ErrArchiveLimit},
+}
+
+func TestTools_ExtractArchiveRejects(t *testing.T) {
+	for _, e := range extractArchiveTests {
+		for format, write := range map[string]func(*testing.T, string, []archiveFile) string{"zip": writeZip, "tar.gz": writeTarGz} {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "out")
+
+			var testTools Tools
+			_, err := testTools.ExtractArchive(write(t, dir, e.files), target, e.limits)
+			if !errors.Is(err, e.expected) {
+				t.Errorf("%s (%s): expected %v, got %v", e.name, format, e.expected, err)
+			}
+
+			if _, err := os.Stat(target); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%s (%s): target directory left behind: %v", e.name, format, err)
+			}
+		}
+	}
+}
+
+func TestTools_ExtractArchiveFileTypes(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out")
+
+	var testTools Tools
+	testTools.AllowedFileTypes = []string{"image/png"}
+
+	p := writeZip(t, dir, []archiveFile{{name: "notes.txt", body: []byte("plain text")}})
+	if _, err := testTools.ExtractArchive(p, target); err == nil {
+		t.Error("expected an error for a disallowed file type")
+	}
+	if _, err := os.Stat(filepath.Join(target, "notes.txt")); !os.IsNotExist(err) {
+		t.Error("disallowed file was extracted")
+	}
+
+	if _, err := testTools.ExtractArchive("./testdata/img.png", target); !errors.Is(err, ErrUnsupportedArchive) {
+		t.Errorf("expected ErrUnsupportedArchive, got %v", err)
+	}
+}
+
+func TestTools_ExtractArchivePaxGlobalHeader(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out")
+	files := []archiveFile{
+		{name: "pax_global_header", paxGlobal: true},
+		{name: "v2/license.md", body: []byte("MIT")},
+	}
+
+	var testTools Tools
+	extracted, err := testTools.ExtractArchive(writeTarGz(t, dir, files), target, ArchiveLimits{MaxEntries: 1})
+	if err != nil {
+		t.Fatalf("error extracting archive: %v", err)
+	}
+	if len(extracted) != 1 || extracted[0].NewFileName != "v2/license.md" {
+		t.Errorf("extracted files not as expected: %+v", extracted)
+	}
+}
+
+func TestTools_ExtractArchiveRollbackKeepsExistingDirs(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out")
+	if err := os.MkdirAll(filepath.Join(target, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var testTools Tools
+	p := writeZip(t, dir, []archiveFile{{name: "a/b/c.txt", body: []byte("c")}, {name: "../evil.txt", body: []byte("x")}})
+	if _, err := testTools.ExtractArchive(p, target); !errors.Is(err, ErrUnsafeArchiveEntry) {
+		t.Fatalf("expected an unsafe entry, got %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(target, "a"))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected the existing directory to be kept and emptied: %v %v", entries, err)
+	}
+}
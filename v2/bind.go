@@ -0,0 +1,337 @@
+package toolkit
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bindSource is where the fields with one struct tag get their values from
+type bindSource struct {
+	tag   string
+	label string
+	get   func(name string) []string
+}
+
+func pathSource(r *http.Request, pathParam func(r *http.Request, name string) string) bindSource {
+	if pathParam == nil {
+		pathParam = func(r *http.Request, name string) string { return r.PathValue(name) }
+	}
+	return bindSource{tag: "path", label: "path parameter", get: func(name string) []string {
+		if v := pathParam(r, name); v != "" {
+			return []string{v}
+		}
+		return nil
+	}}
+}
+
+func querySource(r *http.Request) bindSource {
+	query := r.URL.Query()
+	return bindSource{tag: "query", label: "query parameter", get: func(name string) []string { return query[name] }}
+}
+
+func headerSource(r *http.Request) bindSource {
+	return bindSource{tag: "header", label: "header", get: func(name string) []string { return r.Header.Values(name) }}
+}
+
+func (t *Tools) formSource(r *http.Request) (bindSource, error) {
+	if err := t.parseForm(nil, r); err != nil {
+		return bindSource{}, err
+	}
+	return postFormSource(r), nil
+}
+
+// postFormSource reads the fields of a form body that has been parsed already
+func postFormSource(r *http.Request) bindSource {
+	return bindSource{tag: "form", label: "form field", get: func(name string) []string { return r.PostForm[name] }}
+}
+
+// parseForm parses url encoded and multipart bodies limited to MaxFormSize into r.PostForm,
+// w may be nil
+func (t *Tools) parseForm(w http.ResponseWriter, r *http.Request) error {
+	maxBytes := int64(1024 * 1024) // default one megabyte
+	if t.MaxFormSize > 0 {
+		maxBytes = t.MaxFormSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var err error
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(maxBytes)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return WithStatus(fmt.Errorf("request body must not be larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		}
+		return errors.New("request body contains a badly-formed form")
+	}
+	return nil
+}
+
+// Bind fills the struct dst points to from the request. Fields name their value with the
+// tags `path:"id"` for Go 1.22 path values, `query:"page"`, `form:"title"` and
+// `header:"X-Tenant"`, the first tag with a value wins, and `default:"20"` fills a field
+// that has no value and is still zero. Strings, bools, numbers, time.Time (RFC 3339 or a
+// date), time.Duration, pointers, slices of repeated values and encoding.TextUnmarshaler are
+// supported, embedded structs are bound as well. Errors name the offending parameter. Form
+// bodies are limited to MaxFormSize.
+func (t *Tools) Bind(r *http.Request, dst any) error {
+	sources := []bindSource{pathSource(r, nil), querySource(r), headerSource(r)}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && hasFormTags(dst) {
+		form, err := t.formSource(r)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, form)
+	}
+	return bindValues(dst, sources...)
+}
+
+// BindQuery fills dst from the query string, see Bind
+func (t *Tools) BindQuery(r *http.Request, dst any) error {
+	return bindValues(dst, querySource(r))
+}
+
+// BindPath fills dst from the path values of a Go 1.22 ServeMux pattern, see Bind
+func (t *Tools) BindPath(r *http.Request, dst any) error {
+	return bindValues(dst, pathSource(r, nil))
+}
+
+// BindHeader fills dst from the request headers, see Bind
+func (t *Tools) BindHeader(r *http.Request, dst any) error {
+	return bindValues(dst, headerSource(r))
+}
+
+// BindForm fills dst from an url encoded or multipart form body limited to MaxFormSize, see
+// Bind. A body over the limit is a StatusError with a 413.
+func (t *Tools) BindForm(r *http.Request, dst any) error {
+	form, err := t.formSource(r)
+	if err != nil {
+		return err
+	}
+	return bindValues(dst, form)
+}
+
+// ReadForm reads an url encoded or multipart form body into the struct data points to, like
+// ReadJSON does for JSON: fields are bound by their `form:"name"` tags, see Bind, the body is
+// limited to MaxFormSize and data is validated when it implements Validator
+func (t *Tools) ReadForm(w http.ResponseWriter, r *http.Request, data any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" {
+		return errors.New("request body must be a form")
+	}
+	if err := t.parseForm(w, r); err != nil {
+		return err
+	}
+
+	if err := bindValues(data, postFormSource(r)); err != nil {
+		return err
+	}
+	if v, ok := data.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// bindValues sets the fields of the struct dst points to from the first source with a value
+// for the field's tag, or its default
+func bindValues(dst any, sources ...bindSource) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("binding needs a pointer to a struct")
+	}
+	return bindStruct(v.Elem(), sources)
+}
+
+func bindStruct(v reflect.Value, sources []bindSource) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		// like encoding/json, the exported fields of an unexported embedded struct are bound
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && !hasBindTag(field, sources) {
+			if err := bindStruct(v.Field(i), sources); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		label, name, values := "", "", []string(nil)
+		for _, src := range sources {
+			n := field.Tag.Get(src.tag)
+			if n == "" || n == "-" {
+				continue
+			}
+			if label == "" {
+				label, name = src.label, n
+			}
+			if values = src.get(n); len(values) > 0 {
+				label, name = src.label, n
+				break
+			}
+		}
+		if label == "" {
+			continue
+		}
+		if len(values) == 0 {
+			// a value decoded from a JSON body before binding is not overwritten
+			def, ok := field.Tag.Lookup("default")
+			if !ok || !v.Field(i).IsZero() {
+				continue
+			}
+			values = []string{def}
+			if field.Type.Kind() == reflect.Slice && !isScalar(field.Type) {
+				values = strings.Split(def, ",")
+			}
+		}
+
+		if err := setField(v.Field(i), values); err != nil {
+			return fmt.Errorf("%s %q %s", label, name, err)
+		}
+	}
+	return nil
+}
+
+func hasBindTag(field reflect.StructField, sources []bindSource) bool {
+	for _, src := range sources {
+		if _, ok := field.Tag.Lookup(src.tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFormTags reports whether dst uses the form tag, so Bind only reads the body when asked to
+func hasFormTags(dst any) bool {
+	t := reflect.TypeOf(dst)
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	var walk func(t reflect.Type) bool
+	walk = func(t reflect.Type) bool {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if _, ok := f.Tag.Lookup("form"); ok {
+				return true
+			}
+			if f.Anonymous && f.Type.Kind() == reflect.Struct && walk(f.Type) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(t.Elem())
+}
+
+// isScalar reports whether values of t are parsed from a single string even though t may be
+// a slice, like net.IP
+func isScalar(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// setField sets v from values, all of them for slices and the first one otherwise
+func setField(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && !isScalar(v.Type()) {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+// setValue converts s to the type of v, the error completes a sentence naming the parameter
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) && v.Type() != timeType {
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return fmt.Errorf("contains an invalid value: %v", err)
+		}
+		return nil
+	}
+
+	switch {
+	case v.Type() == timeType:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return errors.New("must be a date or an RFC 3339 time")
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("must be a duration like 90s or 1h30m")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return rangeError(err, "must be a whole number")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return rangeError(err, "must be a positive whole number")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return rangeError(err, "must be a number")
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("cannot be bound to a %s", v.Type())
+	}
+	return nil
+}
+
+func rangeError(err error, msg string) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return errors.New("is out of range")
+	}
+	return errors.New(msg)
+}
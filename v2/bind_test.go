@@ -0,0 +1,252 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pagination struct {
+	Page  int `query:"page" default:"1"`
+	Limit int `query:"limit" default:"20"`
+}
+
+type listOrdersParams struct {
+	pagination
+	ShopID   int64         `path:"shop"`
+	Status   []string      `query:"status"`
+	Since    time.Time     `query:"since"`
+	Timeout  time.Duration `query:"timeout" default:"30s"`
+	Archived *bool         `query:"archived"`
+	Tenant   string        `header:"X-Tenant" query:"tenant"`
+	ClientIP net.IP        `header:"X-Client-IP"`
+	Ratio    float64       `query:"ratio"`
+	ignored  string        `query:"ignored"`
+}
+
+var bindTests = []struct {
+	name          string
+	url           string
+	headers       map[string]string
+	expected      listOrdersParams
+	errorExpected string
+}{
+	{
+		name:     "defaults",
+		url:      "/shops/7/orders",
+		expected: listOrdersParams{pagination: pagination{Page: 1, Limit: 20}, ShopID: 7, Timeout: 30 * time.Second},
+	},
+	{
+		name:    "all values",
+		url:     "/shops/7/orders?page=3&limit=50&status=open&status=paid&since=2024-05-01&timeout=2m&archived=true&tenant=q&ratio=0.5&ignored=x",
+		headers: map[string]string{"X-Tenant": "acme", "X-Client-IP": "192.0.2.4"},
+		expected: listOrdersParams{
+			pagination: pagination{Page: 3, Limit: 50}, ShopID: 7,
+			Status: []string{"open", "paid"}, Since: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			Timeout: 2 * time.Minute, Archived: ptr(true), Tenant: "q",
+			ClientIP: net.ParseIP("192.0.2.4"), Ratio: 0.5,
+		},
+	},
+	{
+		name:     "header when the query is missing",
+		url:      "/shops/7/orders?since=2024-05-01T10:00:00Z",
+		headers:  map[string]string{"X-Tenant": "acme"},
+		expected: listOrdersParams{pagination: pagination{Page: 1, Limit: 20}, ShopID: 7, Since: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Timeout: 30 * time.Second, Tenant: "acme"},
+	},
+	{name: "bad int", url: "/shops/7/orders?page=two", errorExpected: `query parameter "page" must be a whole number`},
+	{name: "out of range", url: "/shops/99999999999999999999/orders", errorExpected: `path parameter "shop" is out of range`},
+	{name: "bad bool", url: "/shops/7/orders?archived=maybe", errorExpected: `query parameter "archived" must be true or false`},
+	{name: "bad time", url: "/shops/7/orders?since=yesterday", errorExpected: `query parameter "since" must be a date or an RFC 3339 time`},
+	{name: "bad duration", url: "/shops/7/orders?timeout=soon", errorExpected: `query parameter "timeout" must be a duration like 90s or 1h30m`},
+	{name: "bad text unmarshaler", url: "/shops/7/orders", headers: map[string]string{"X-Client-IP": "nope"}, errorExpected: `header "X-Client-IP" contains an invalid value`},
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestTools_Bind(t *testing.T) {
+	var testTools Tools
+	for _, e := range bindTests {
+		var got listOrdersParams
+		mux := http.NewServeMux()
+		var err error
+		mux.HandleFunc("GET /shops/{shop}/orders", func(w http.ResponseWriter, r *http.Request) {
+			err = testTools.Bind(r, &got)
+		})
+		req := httptest.NewRequest("GET", e.url, nil)
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+
+		if e.errorExpected != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), e.errorExpected) {
+				t.Errorf("%s: expected error %q, got %v", e.name, e.errorExpected, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, e.expected) {
+			t.Errorf("%s: got %+v", e.name, got)
+		}
+	}
+}
+
+func TestTools_BindForm(t *testing.T) {
+	var testTools Tools
+	var params struct {
+		Title string   `form:"title"`
+		Tags  []string `form:"tag"`
+		Draft bool     `form:"draft" default:"true"`
+		Page  int      `query:"page"`
+	}
+
+	form := url.Values{"title": {"Hello"}, "tag": {"a", "b"}}
+	req := httptest.NewRequest("POST", "/posts?page=2", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := testTools.Bind(req, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Title != "Hello" || len(params.Tags) != 2 || !params.Draft || params.Page != 2 {
+		t.Errorf("form not bound: %+v", params)
+	}
+
+	if err := testTools.BindQuery(req, params); err == nil {
+		t.Error("expected an error for a non pointer")
+	}
+	testTools.MaxFormSize = 50
+	for _, bind := range []func(*http.Request, any) error{testTools.Bind, testTools.BindForm} {
+		req = httptest.NewRequest("POST", "/posts", strings.NewReader("title="+strings.Repeat("x", 100)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		err := bind(req, &params)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.Status != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected a 413 for a body over MaxFormSize, got %v", err)
+		}
+	}
+}
+
+type contactForm struct {
+	Name    string `form:"name"`
+	Email   string `form:"email"`
+	Age     int    `form:"age"`
+	Subject string `form:"subject" default:"general"`
+}
+
+func (f *contactForm) Validate() error {
+	if !strings.Contains(f.Email, "@") {
+		return errors.New("email is not valid")
+	}
+	return nil
+}
+
+var readFormTests = []struct {
+	name          string
+	body          string
+	contentType   string
+	maxSize       int64
+	errorExpected string
+}{
+	{name: "valid", body: "name=Jane&email=jane%40example.com&age=31"},
+	{name: "invalid", body: "name=Jane&email=nope", errorExpected: "email is not valid"},
+	{name: "bad value", body: "email=a%40b&age=old", errorExpected: `form field "age" must be a whole number`},
+	{name: "too large", body: "email=a%40b&name=" + strings.Repeat("x", 100), maxSize: 50, errorExpected: "request body must not be larger than 50 bytes"},
+	{name: "not a form", body: `{"email":"a@b"}`, contentType: "application/json", errorExpected: "request body must be a form"},
+}
+
+func TestTools_ReadForm(t *testing.T) {
+	for _, e := range readFormTests {
+		var testTools Tools
+		testTools.MaxFormSize = e.maxSize
+		contentType := e.contentType
+		if contentType == "" {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		req := httptest.NewRequest("POST", "/contact", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", contentType)
+
+		var form contactForm
+		err := testTools.ReadForm(httptest.NewRecorder(), req, &form)
+		if e.errorExpected != "" {
+			if err == nil || err.Error() != e.errorExpected {
+				t.Errorf("%s: expected %q, got %v", e.name, e.errorExpected, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if form != (contactForm{Name: "Jane", Email: "jane@example.com", Age: 31, Subject: "general"}) {
+			t.Errorf("%s: form not as expected: %+v", e.name, form)
+		}
+	}
+}
+
+type photoForm struct {
+	Title string   `form:"title"`
+	Tags  []string `form:"tag"`
+}
+
+func (f *photoForm) Validate() error {
+	if f.Title == "" {
+		return errors.New("title is required")
+	}
+	return nil
+}
+
+func photoRequest(t *testing.T, fields url.Values) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, values := range fields {
+		for _, v := range values {
+			_ = writer.WriteField(name, v)
+		}
+	}
+	part, err := writer.CreateFormFile("file", "photo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte("pretend this is a photo"))
+	_ = writer.Close()
+
+	req := httptest.NewRequest("POST", "/photos", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestTools_UploadFilesWithForm(t *testing.T) {
+	var testTools Tools
+	uploadDir := t.TempDir()
+
+	var form photoForm
+	files, err := testTools.UploadFilesWithForm(photoRequest(t, url.Values{"title": {"Sunset"}, "tag": {"sea", "sky"}}), uploadDir, &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || form.Title != "Sunset" || len(form.Tags) != 2 {
+		t.Errorf("upload not as expected: %d files, %+v", len(files), form)
+	}
+
+	emptyDir := t.TempDir()
+	form = photoForm{}
+	if _, err := testTools.UploadFilesWithForm(photoRequest(t, url.Values{"tag": {"sea"}}), emptyDir, &form); err == nil || err.Error() != "title is required" {
+		t.Errorf("expected the validation error, got %v", err)
+	}
+	if entries, _ := os.ReadDir(emptyDir); len(entries) != 0 {
+		t.Errorf("files stored for an invalid form: %d", len(entries))
+	}
+}
@@ -0,0 +1,240 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// contentDisposition is the attachment header for displayName. Names that are not plain ASCII
+// get a transliterated fallback plus the exact name as RFC 5987 filename*, which all current
+// browsers prefer.
+func contentDisposition(displayName string) string {
+	var b strings.Builder
+	ascii := true
+	for _, r := range displayName {
+		switch {
+		case r == '"' || r == '\\' || r < 0x20 || r == 0x7f:
+			b.WriteRune('_')
+		case r > unicode.MaxASCII:
+			ascii = false
+			for _, c := range transliterateCased(r, SlugOptions{}) {
+				if c > unicode.MaxASCII {
+					c = '_'
+				}
+				b.WriteRune(c)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	if ascii {
+		return fmt.Sprintf("attachment; filename=\"%s\"", b.String())
+	}
+	return fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", b.String(), rfc5987Escape(displayName))
+}
+
+// rfc5987Escape percent-encodes everything but the attr-chars of RFC 5987
+func rfc5987Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || strings.IndexByte("!#$&+-.^_`|~", c) >= 0) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// ZipEntry is a file to put into a ZIP download
+type ZipEntry struct {
+	// Path of the file, in the file system passed to DownloadZip or on disk
+	Path string
+	// Name of the file inside the archive, defaults to the base name of Path. Slashes create
+	// folders in the archive.
+	Name string
+}
+
+// DownloadZip streams a ZIP archive of entries to w, named displayName. The files are read
+// from fsys, or from disk when fsys is nil, and compressed while they are sent, so nothing is
+// buffered or written to temporary files. Every entry is checked before the response starts,
+// a missing file is reported with ErrorJSON and a 404. Once streaming has started errors can
+// only be returned, and a cancelled request stops the archive at the next read.
+func (t *Tools) DownloadZip(w http.ResponseWriter, r *http.Request, fsys fs.FS, displayName string, entries ...ZipEntry) error {
+	open := func(name string) (fs.File, error) {
+		if fsys == nil {
+			return os.Open(name)
+		}
+		return fsys.Open(name)
+	}
+
+	names := make(map[string]bool)
+	headers := make([]*zip.FileHeader, len(entries))
+	for i, entry := range entries {
+		f, err := open(entry.Path)
+		if err == nil {
+			var info fs.FileInfo
+			info, err = f.Stat()
+			f.Close()
+			if err == nil && !info.Mode().IsRegular() {
+				err = fmt.Errorf("%s is not a regular file", entry.Path)
+			}
+			if err == nil {
+				headers[i], err = zipHeader(entry, info, names)
+			}
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			_ = t.ErrorJSON(w, errors.New("file not found"), http.StatusNotFound)
+			return err
+		}
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return err
+		}
+	}
+
+	release, err := t.Throttle.acquire(r.Context())
+	if err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+		return err
+	}
+	defer release()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition(displayName))
+	w.WriteHeader(http.StatusOK)
+
+	ctx := r.Context()
+	zw := zip.NewWriter(t.Throttle.responseWriter(ctx, w))
+	for i, entry := range entries {
+		if err := t.writeZipEntry(ctx, zw, open, entry.Path, headers[i]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// zipHeader is the header of entry in the archive, it makes the name safe to extract and
+// unique by numbering repeated names
+func zipHeader(entry ZipEntry, info fs.FileInfo, names map[string]bool) (*zip.FileHeader, error) {
+	name := entry.Name
+	if name == "" {
+		name = path.Base(strings.ReplaceAll(entry.Path, `\`, "/"))
+	}
+	name = strings.TrimLeft(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+	if name == "" || name == "." {
+		return nil, fmt.Errorf("%s has no usable name", entry.Path)
+	}
+
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 2; names[name]; n++ {
+		name = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+	}
+	names[name] = true
+
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = name
+	hdr.Method = zip.Deflate
+	return hdr, nil
+}
+
+func (t *Tools) writeZipEntry(ctx context.Context, zw *zip.Writer, open func(string) (fs.File, error), p string, hdr *zip.FileHeader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dst, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, contextReader{ctx: ctx, r: f})
+	return err
+}
+
+// contextReader fails reads once ctx is done, which ends a copy to a client that went away
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// ListingEntry is one entry of a directory listing
+type ListingEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+}
+
+// ListDirectory returns the entries of dir in fsys, or on disk when fsys is nil, sorted by
+// name. Hidden entries starting with a dot, like the .resumable and .quarantine state
+// directories, are left out.
+func (t *Tools) ListDirectory(fsys fs.FS, dir string) ([]ListingEntry, error) {
+	var entries []fs.DirEntry
+	var err error
+	if fsys == nil {
+		entries, err = os.ReadDir(dir)
+	} else {
+		entries, err = fs.ReadDir(fsys, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	listing := make([]ListingEntry, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		item := ListingEntry{Name: entry.Name(), ModTime: info.ModTime(), IsDir: entry.IsDir()}
+		if !entry.IsDir() {
+			item.Size = info.Size()
+		}
+		listing = append(listing, item)
+	}
+	sort.Slice(listing, func(a, b int) bool { return listing[a].Name < listing[b].Name })
+	return listing, nil
+}
+
+// DirectoryListing writes the listing of dir as JSON, a directory that cannot be read is
+// reported with ErrorJSON and a 404
+func (t *Tools) DirectoryListing(w http.ResponseWriter, r *http.Request, fsys fs.FS, dir string) error {
+	listing, err := t.ListDirectory(fsys, dir)
+	if err != nil {
+		_ = t.ErrorJSON(w, errors.New("directory not found"), http.StatusNotFound)
+		return err
+	}
+	return t.WriteJSON(w, listing, http.StatusOK)
+}
@@ -0,0 +1,164 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var contentDispositionTests = []struct {
+	name     string
+	in       string
+	expected string
+}{
+	{name: "ascii", in: "report.pdf", expected: `attachment; filename="report.pdf"`},
+	{name: "quotes", in: `a "b".txt`, expected: `attachment; filename="a _b_.txt"`},
+	{name: "unicode", in: "Çağrı 1;2.txt", expected: `attachment; filename="Cagri 1;2.txt"; filename*=UTF-8''%C3%87a%C4%9Fr%C4%B1%201%3B2.txt`},
+}
+
+func TestContentDisposition(t *testing.T) {
+	for _, e := range contentDispositionTests {
+		if got := contentDisposition(e.in); got != e.expected {
+			t.Errorf("%s: got %s", e.name, got)
+		}
+	}
+}
+
+func TestTools_DownloadZip(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"uploads/a1b2.pdf": {Data: []byte("invoice"), ModTime: modTime},
+		"uploads/c3d4.txt": {Data: bytes.Repeat([]byte("notes "), 1000), ModTime: modTime},
+		"uploads/e5f6.txt": {Data: []byte("more notes"), ModTime: modTime},
+	}
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/attachments.zip", nil)
+	err := testTools.DownloadZip(rr, req, fsys, "Ekler.zip",
+		ZipEntry{Path: "uploads/a1b2.pdf", Name: "Invoice.pdf"},
+		ZipEntry{Path: "uploads/c3d4.txt", Name: "../../notes.txt"},
+		ZipEntry{Path: "uploads/e5f6.txt", Name: "notes.txt"},
+		ZipEntry{Path: "uploads/a1b2.pdf"},
+	)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if rr.Header().Get("Content-Type") != "application/zip" || rr.Header().Get("Content-Disposition") != `attachment; filename="Ekler.zip"` {
+		t.Errorf("headers not as expected: %v", rr.Header())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	expected := map[string]string{
+		"Invoice.pdf":   "invoice",
+		"notes.txt":     string(fsys["uploads/c3d4.txt"].Data),
+		"notes (2).txt": "more notes",
+		"a1b2.pdf":      "invoice",
+	}
+	if len(zr.File) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(zr.File))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != expected[f.Name] {
+			t.Errorf("%s: content not as expected", f.Name)
+		}
+		if !f.Modified.Equal(modTime) {
+			t.Errorf("%s: modification time not kept: %v", f.Name, f.Modified)
+		}
+	}
+}
+
+func TestTools_DownloadZipFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "photo.png")
+	if err := os.WriteFile(p, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	if err := testTools.DownloadZip(rr, httptest.NewRequest("GET", "/", nil), nil, "all.zip", ZipEntry{Path: p}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil || len(zr.File) != 1 || zr.File[0].Name != "photo.png" {
+		t.Errorf("archive not as expected: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	err = testTools.DownloadZip(rr, httptest.NewRequest("GET", "/", nil), nil, "all.zip", ZipEntry{Path: p}, ZipEntry{Path: filepath.Join(dir, "missing")})
+	if err == nil || rr.Code != http.StatusNotFound {
+		t.Errorf("expected a 404 for a missing file, got %d, %v", rr.Code, err)
+	}
+	var payload JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil || !payload.Error {
+		t.Errorf("error response not as expected: %s", rr.Body.String())
+	}
+}
+
+func TestTools_DownloadZipCancelled(t *testing.T) {
+	fsys := fstest.MapFS{"big.bin": {Data: make([]byte, 1<<20)}}
+	var testTools Tools
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if err := testTools.DownloadZip(rr, req, fsys, "big.zip", ZipEntry{Path: "big.bin"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the archive to stop, got %v", err)
+	}
+	if rr.Body.Len() > 1<<10 {
+		t.Errorf("%d bytes written after cancellation", rr.Body.Len())
+	}
+}
+
+func TestTools_DirectoryListing(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"uploads/b.txt":           {Data: []byte("12345"), ModTime: modTime},
+		"uploads/a.png":           {Data: []byte("1"), ModTime: modTime},
+		"uploads/2024/01/c.txt":   {Data: []byte("1")},
+		"uploads/.quarantine/x":   {Data: []byte("1")},
+		"uploads/.resumable/y.in": {Data: []byte("1")},
+	}
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	if err := testTools.DirectoryListing(rr, httptest.NewRequest("GET", "/", nil), fsys, "uploads"); err != nil {
+		t.Fatal(err)
+	}
+	var listing []ListingEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != 3 || listing[0].Name != "2024" || !listing[0].IsDir || listing[1].Name != "a.png" {
+		t.Fatalf("listing not as expected: %+v", listing)
+	}
+	if listing[2].Size != 5 || !listing[2].ModTime.Equal(modTime) {
+		t.Errorf("entry not as expected: %+v", listing[2])
+	}
+
+	rr = httptest.NewRecorder()
+	if err := testTools.DirectoryListing(rr, httptest.NewRequest("GET", "/", nil), fsys, "missing"); err == nil || rr.Code != http.StatusNotFound {
+		t.Errorf("expected a 404, got %d", rr.Code)
+	}
+}
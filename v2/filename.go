@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FilenameOptions configures SanitizeFilename
+type FilenameOptions struct {
+	// Transliterate romanises the name like Slugify does, keeping the case of each letter
+	Transliterate bool
+	// Language selects the transliteration table, see SlugLanguages
+	Language string
+	// MaxBytes caps the length of the name including its extension, defaults to 255, the
+	// limit of ext4, NTFS and APFS
+	MaxBytes int
+	// Replacement is used for reserved and control characters, defaults to "_"
+	Replacement string
+}
+
+// windowsReserved are device names Windows refuses as file names, with or without extension
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFilename turns an untrusted name, such as the OriginalFileName of an upload, into a
+// name that is safe on Linux, Windows and macOS. Directories are stripped, reserved and
+// control characters replaced, Windows device names prefixed, leading dots and trailing dots
+// and spaces trimmed and the name shortened to MaxBytes, keeping its extension and case.
+func (t *Tools) SanitizeFilename(name string, options ...FilenameOptions) (string, error) {
+	var opts FilenameOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 255
+	}
+	if opts.Replacement == "" || strings.ContainsAny(opts.Replacement, `<>:"/\|?*.`) {
+		opts.Replacement = "_"
+	}
+
+	// both separators, a name from a Windows browser may carry a full path
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToValidUTF8(name, opts.Replacement)
+
+	var b strings.Builder
+	var prev rune
+	for _, r := range name {
+		switch {
+		case r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"|?*`, r):
+			b.WriteString(opts.Replacement)
+		case opts.Transliterate && unicode.Is(unicode.Mn, r) && prev <= unicode.MaxASCII:
+			// a diacritic on a romanised letter
+		case opts.Transliterate:
+			b.WriteString(transliterateCased(r, SlugOptions{Language: opts.Language}))
+		default:
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	name = strings.TrimLeft(strings.TrimRight(b.String(), ". "), ". ")
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimRight(strings.TrimSuffix(name, ext), ". ")
+	if stem == "" {
+		// a name like ".txt" is all extension
+		stem, ext = strings.TrimPrefix(ext, "."), ""
+	}
+	if stem == "" {
+		return "", errors.New("file name is empty")
+	}
+
+	if base, _, _ := strings.Cut(stem, "."); windowsReserved[strings.ToUpper(strings.TrimSpace(base))] {
+		stem = opts.Replacement + stem
+	}
+
+	if len(ext) >= opts.MaxBytes {
+		return "", errors.New("file name extension is too long")
+	}
+	stem = truncateUTF8(stem, opts.MaxBytes-len(ext))
+	stem = strings.TrimRight(stem, ". ")
+	if stem == "" {
+		return "", errors.New("file name is empty")
+	}
+	return stem + ext, nil
+}
+
+// transliterateCased romanises r like transliterateRune but keeps it upper case
+func transliterateCased(r rune, opts SlugOptions) string {
+	lower := unicode.ToLower(r)
+	v := transliterateRune(lower, opts)
+	if lower == r || v == "" {
+		return v
+	}
+	first, size := utf8.DecodeRuneInString(v)
+	return string(unicode.ToUpper(first)) + v[size:]
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// keepFileName is the name of an upload that is not renamed, sanitised when
+// SanitizeFileNames is set
+func (t *Tools) keepFileName(originalName string) (string, error) {
+	if !t.SanitizeFileNames {
+		return originalName, nil
+	}
+	return t.SanitizeFilename(originalName, t.FilenameOptions)
+}
@@ -0,0 +1,75 @@
+package toolkit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var sanitizeFilenameTests = []struct {
+	name          string
+	in            string
+	opts          FilenameOptions
+	expected      string
+	errorExpected bool
+}{
+	{name: "plain", in: "Report 2024.PDF", expected: "Report 2024.PDF"},
+	{name: "unix path", in: "../../etc/passwd", expected: "passwd"},
+	{name: "windows path", in: `C:\Users\jane\My Photo.jpg`, expected: "My Photo.jpg"},
+	{name: "reserved characters", in: `a<b>c:d"e|f?g*h.txt`, expected: "a_b_c_d_e_f_g_h.txt"},
+	{name: "control characters", in: "bad\x00name\x1f.txt", expected: "bad_name_.txt"},
+	{name: "custom replacement", in: "what?.txt", opts: FilenameOptions{Replacement: "-"}, expected: "what-.txt"},
+	{name: "reserved name", in: "con.txt", expected: "_con.txt"},
+	{name: "reserved name without extension", in: "LPT1", expected: "_LPT1"},
+	{name: "reserved name with two extensions", in: "nul.tar.gz", expected: "_nul.tar.gz"},
+	{name: "not reserved", in: "console.txt", expected: "console.txt"},
+	{name: "trailing dots and spaces", in: "notes. . ", expected: "notes"},
+	{name: "trailing dots before the extension", in: "notes...txt", expected: "notes.txt"},
+	{name: "leading dots", in: "..hidden", expected: "hidden"},
+	{name: "only extension", in: ".env", expected: "env"},
+	{name: "unicode kept", in: "Çağrı Göğüş.png", expected: "Çağrı Göğüş.png"},
+	{name: "transliterated", in: "Çağrı Göğüş.png", opts: FilenameOptions{Transliterate: true}, expected: "Cagri Gogus.png"},
+	{name: "transliterated german", in: "Übersicht Größe.docx", opts: FilenameOptions{Transliterate: true, Language: "de"}, expected: "Uebersicht Groesse.docx"},
+	{name: "transliterated cyrillic", in: "Щука.txt", opts: FilenameOptions{Transliterate: true}, expected: "Shchuka.txt"},
+	{name: "byte limit keeps extension", in: strings.Repeat("a", 300) + ".jpeg", expected: strings.Repeat("a", 250) + ".jpeg"},
+	{name: "byte limit respects runes", in: "ğğğğ.txt", opts: FilenameOptions{MaxBytes: 9}, expected: "ğğ.txt"},
+	{name: "empty", in: "", errorExpected: true},
+	{name: "only dots", in: "...", errorExpected: true},
+	{name: "only a path", in: "dir/", errorExpected: true},
+}
+
+func TestTools_SanitizeFilename(t *testing.T) {
+	var testTools Tools
+	for _, e := range sanitizeFilenameTests {
+		name, err := testTools.SanitizeFilename(e.in, e.opts)
+		if err != nil && !e.errorExpected {
+			t.Errorf("%s: Error sanitizing file name: %v", e.name, err)
+		}
+		if err == nil && e.errorExpected {
+			t.Errorf("%s: expected an error, got %q", e.name, name)
+		}
+		if name != e.expected {
+			t.Errorf("%s: file name not as expected: %q", e.name, name)
+		}
+	}
+}
+
+func TestTools_UploadFilesSanitizesNames(t *testing.T) {
+	uploadDir := t.TempDir()
+
+	var testTools Tools
+	testTools.SanitizeFileNames = true
+	testTools.FilenameOptions = FilenameOptions{Transliterate: true}
+
+	files, err := testTools.UploadFiles(multipartRequest(t, "Çağrı: notes?.txt", []byte("hello")), uploadDir, false)
+	if err != nil {
+		t.Fatalf("Error uploading file: %v", err)
+	}
+	if files[0].NewFileName != "Cagri_ notes_.txt" || files[0].OriginalFileName != "Çağrı: notes?.txt" {
+		t.Errorf("file names not as expected: %+v", files[0])
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, files[0].NewFileName)); err != nil {
+		t.Errorf("file not stored under the sanitized name: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// ErrNotDirectory is returned when a directory is expected but the path is something else
+var ErrNotDirectory = errors.New("not a directory")
+
+// DirOptions configures CreateDir
+type DirOptions struct {
+	// Mode of the created directories. It is applied with chmod after creating them, so the
+	// process umask cannot silently narrow it. Without a mode directories get 0755 narrowed by
+	// the umask.
+	Mode os.FileMode
+	// Chown sets the owner of the created directories to UID and GID
+	Chown bool
+	UID   int
+	GID   int
+	// VerifyWritable checks the directory can be written to by creating and removing a file
+	VerifyWritable bool
+}
+
+// CreateDir creates path and any missing parents and reports whether it had to create path.
+// Only directories created by the call get Mode and owner, existing ones are left alone. An
+// existing path that is a file or a dangling symlink is an error.
+func (t *Tools) CreateDir(path string, opts DirOptions) (bool, error) {
+	mode := opts.Mode.Perm()
+
+	missing, err := missingDirs(path)
+	if err != nil {
+		return false, err
+	}
+
+	if len(missing) > 0 {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return false, err
+		}
+		// deepest first, so a restrictive mode on a parent cannot keep a child from being fixed up
+		for _, dir := range missing {
+			if mode != 0 {
+				if err := os.Chmod(dir, mode); err != nil {
+					return true, err
+				}
+			}
+			if opts.Chown {
+				if err := os.Chown(dir, opts.UID, opts.GID); err != nil {
+					return true, err
+				}
+			}
+		}
+	}
+
+	if opts.VerifyWritable {
+		f, err := os.CreateTemp(path, ".writable-*")
+		if err != nil {
+			return len(missing) > 0, fmt.Errorf("directory %s is not writable: %w", path, err)
+		}
+		f.Close()
+		_ = os.Remove(f.Name())
+	}
+	return len(missing) > 0, nil
+}
+
+// missingDirs returns path and those of its parents that do not exist yet, deepest first
+func missingDirs(path string) ([]string, error) {
+	var missing []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		info, err := os.Stat(p)
+		if err == nil {
+			if !info.IsDir() {
+				return nil, fmt.Errorf("%s: %w", p, ErrNotDirectory)
+			}
+			return missing, nil
+		}
+		// below a file stat fails with ENOTDIR, walk up to report the file itself
+		if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR) {
+			return nil, err
+		}
+		if l, lerr := os.Lstat(p); lerr == nil && l.Mode()&os.ModeSymlink != 0 {
+			return nil, fmt.Errorf("%s is a dangling symlink: %w", p, ErrNotDirectory)
+		}
+
+		missing = append(missing, p)
+		if parent := filepath.Dir(p); parent == p {
+			return missing, nil
+		}
+	}
+}
+
+// AtomicWriteFile writes data to filename so readers see either the old or the complete new
+// content: it writes a temporary file in the same directory, syncs it, renames it over
+// filename and syncs the directory
+func (t *Tools) AtomicWriteFile(filename string, data []byte, perm os.FileMode) error {
+	_, err := t.AtomicWriteFromReader(filename, bytes.NewReader(data), perm)
+	return err
+}
+
+// AtomicWriteFromReader is AtomicWriteFile for content read from r, it returns the number of
+// bytes written. Nothing is left behind when reading or writing fails.
+func (t *Tools) AtomicWriteFromReader(filename string, r io.Reader, perm os.FileMode) (int64, error) {
+	dir := filepath.Dir(filename)
+
+	// a short fixed name, the target name may already be as long as the file system allows
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	// removing fails harmlessly once the rename went through
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return 0, err
+	}
+	return n, syncDir(dir)
+}
+
+// syncDir makes a rename in dir durable, Windows cannot sync directories and does not need to
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// CopyFile copies a regular file atomically, preserving its permission bits and modification
+// time, and returns the number of bytes copied
+func (t *Tools) CopyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s is not a regular file", src)
+	}
+
+	n, err := t.AtomicWriteFromReader(dst, in, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// MoveFile renames src to dst, falling back to copy and delete when they are on different
+// devices, where a plain rename fails
+func (t *Tools) MoveFile(src, dst string) error {
+	err := rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if _, err := t.CopyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// createParentDir creates the directory filename is about to be written to, naming strategies
+// may put uploads into subdirectories
+func (t *Tools) createParentDir(filename string) error {
+	return t.CreateDirIfNotExists(filepath.Dir(filename))
+}
+
+// rename is os.Rename, replaced in tests to simulate moves across devices
+var rename = os.Rename
+
+// DiskUsage is the result of walking a directory tree
+type DiskUsage struct {
+	Files int64
+	Dirs  int64
+	Bytes int64
+}
+
+// DiskUsage adds up the sizes of the regular files below root, symlinks are not followed
+func (t *Tools) DiskUsage(root string) (DiskUsage, error) {
+	var usage DiskUsage
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if p != root {
+				usage.Dirs++
+			}
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			usage.Files++
+			usage.Bytes += info.Size()
+		}
+		return nil
+	})
+	return usage, err
+}
+
+// WithTempDir creates a temporary directory, named after pattern like os.MkdirTemp, passes
+// it to fn and removes it with everything inside once fn returns
+func (t *Tools) WithTempDir(pattern string, fn func(dir string) error) error {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	return fn(dir)
+}
@@ -0,0 +1,257 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestTools_CreateDir(t *testing.T) {
+	root := t.TempDir()
+	var testTools Tools
+
+	dir := filepath.Join(root, "a", "b", "c")
+	created, err := testTools.CreateDir(dir, DirOptions{Mode: 0750, VerifyWritable: true})
+	if err != nil || !created {
+		t.Fatalf("directory not created: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		for _, p := range []string{filepath.Join(root, "a"), filepath.Join(root, "a", "b"), dir} {
+			info, err := os.Stat(p)
+			if err != nil || info.Mode().Perm() != 0750 {
+				t.Errorf("%s: mode not as expected: %v, %v", p, info.Mode(), err)
+			}
+		}
+	}
+
+	created, err = testTools.CreateDir(dir, DirOptions{Mode: 0700})
+	if err != nil || created {
+		t.Errorf("existing directory reported as created: %v", err)
+	}
+	if info, _ := os.Stat(dir); runtime.GOOS != "windows" && info.Mode().Perm() != 0750 {
+		t.Errorf("existing directory mode changed to %v", info.Mode())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("writable check left %d files behind", len(entries))
+	}
+}
+
+func TestTools_CreateDirNotADirectory(t *testing.T) {
+	root := t.TempDir()
+	var testTools Tools
+
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testTools.CreateDir(file, DirOptions{}); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory for a file, got %v", err)
+	}
+	if err := testTools.CreateDirIfNotExists(filepath.Join(file, "sub")); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory below a file, got %v", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	link := filepath.Join(root, "dangling")
+	if err := os.Symlink(filepath.Join(root, "missing"), link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testTools.CreateDir(link, DirOptions{}); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("expected ErrNotDirectory for a dangling symlink, got %v", err)
+	}
+}
+
+func TestTools_CreateDirNotWritable(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced")
+	}
+	root := t.TempDir()
+	var testTools Tools
+
+	dir := filepath.Join(root, "readonly")
+	if _, err := testTools.CreateDir(dir, DirOptions{Mode: 0500, VerifyWritable: true}); err == nil {
+		t.Error("expected an error for a read only directory")
+	}
+	_ = os.Chmod(dir, 0700)
+}
+
+func TestTools_CreateDirIfNotExistsDirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes are not supported")
+	}
+	var testTools Tools
+	testTools.DirMode = 0750
+
+	dir := filepath.Join(t.TempDir(), "uploads")
+	if err := testTools.CreateDirIfNotExists(dir); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0750 {
+		t.Errorf("mode not as expected: %v", info.Mode())
+	}
+	// without DirMode the umask applies, as it does to os.Mkdir
+	testTools.DirMode = 0
+	dir = filepath.Join(t.TempDir(), "uploads")
+	if err := testTools.CreateDirIfNotExists(dir); err != nil {
+		t.Fatal(err)
+	}
+	reference := filepath.Join(t.TempDir(), "reference")
+	if err := os.Mkdir(reference, 0755); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(dir)
+	want, _ := os.Stat(reference)
+	if info.Mode().Perm() != want.Mode().Perm() {
+		t.Errorf("mode %v, expected %v", info.Mode().Perm(), want.Mode().Perm())
+	}
+}
+
+func TestTools_AtomicWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	var testTools Tools
+
+	p := filepath.Join(dir, "config.json")
+	if err := testTools.AtomicWriteFile(p, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := testTools.AtomicWriteFile(p, []byte("new"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil || string(data) != "new" {
+		t.Errorf("content not as expected: %q, %v", data, err)
+	}
+	if info, _ := os.Stat(p); runtime.GOOS != "windows" && info.Mode().Perm() != 0640 {
+		t.Errorf("mode not as expected: %v", info.Mode())
+	}
+
+	// a failing reader keeps the old content and leaves no temporary file
+	_, err = testTools.AtomicWriteFromReader(p, io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset"))), 0640)
+	if err == nil {
+		t.Error("expected the read error")
+	}
+	if data, _ := os.ReadFile(p); string(data) != "new" {
+		t.Errorf("content replaced by a failed write: %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only the target file, found %d entries", len(entries))
+	}
+	// the longest name SanitizeFilename accepts
+	long := filepath.Join(dir, strings.Repeat("a", 250)+".json")
+	if err := testTools.AtomicWriteFile(long, []byte("x"), 0600); err != nil {
+		t.Errorf("long file name: %v", err)
+	}
+}
+
+func TestTools_CopyFile(t *testing.T) {
+	dir := t.TempDir()
+	var testTools Tools
+
+	src := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(src, []byte("#!/bin/sh\necho hi\n"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_ = os.Chtimes(src, modTime, modTime)
+
+	dst := filepath.Join(dir, "copy.sh")
+	n, err := testTools.CopyFile(src, dst)
+	if err != nil || n != 18 {
+		t.Fatalf("copy failed: %d, %v", n, err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0750 {
+		t.Errorf("mode not preserved: %v", info.Mode())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("modification time not preserved: %v", info.ModTime())
+	}
+
+	if _, err := testTools.CopyFile(dir, filepath.Join(dir, "x")); err == nil {
+		t.Error("expected an error copying a directory")
+	}
+}
+
+func TestTools_MoveFile(t *testing.T) {
+	dir := t.TempDir()
+	var testTools Tools
+
+	for _, crossDevice := range []bool{false, true} {
+		src, dst := filepath.Join(dir, "src.txt"), filepath.Join(dir, "dst.txt")
+		if err := os.WriteFile(src, []byte("payload"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if crossDevice {
+			rename = func(oldpath, newpath string) error {
+				return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+			}
+		}
+		err := testTools.MoveFile(src, dst)
+		rename = os.Rename
+
+		if err != nil {
+			t.Fatalf("cross device %v: move failed: %v", crossDevice, err)
+		}
+		if _, err := os.Stat(src); !os.IsNotExist(err) {
+			t.Errorf("cross device %v: source still exists", crossDevice)
+		}
+		if data, _ := os.ReadFile(dst); string(data) != "payload" {
+			t.Errorf("cross device %v: content not as expected: %q", crossDevice, data)
+		}
+		_ = os.Remove(dst)
+	}
+}
+
+func TestTools_DiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	var testTools Tools
+
+	_ = os.MkdirAll(filepath.Join(dir, "a", "b"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "one"), make([]byte, 100), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "a", "two"), make([]byte, 20), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "a", "b", "three"), make([]byte, 3), 0644)
+
+	usage, err := testTools.DiskUsage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != (DiskUsage{Files: 3, Dirs: 2, Bytes: 123}) {
+		t.Errorf("usage not as expected: %+v", usage)
+	}
+}
+
+func TestTools_WithTempDir(t *testing.T) {
+	var testTools Tools
+
+	var scoped string
+	err := testTools.WithTempDir("toolkit-*", func(dir string) error {
+		scoped = dir
+		return os.WriteFile(filepath.Join(dir, "f"), []byte("x"), 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(scoped); !os.IsNotExist(err) {
+		t.Errorf("temporary directory %s not removed", scoped)
+	}
+
+	expected := errors.New("failed")
+	if err := testTools.WithTempDir("toolkit-*", func(string) error { return expected }); err != expected {
+		t.Errorf("error of fn not returned: %v", err)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/cagrigit-hub/toolkit/v2
 
-go 1.20
+go 1.22
+
+require golang.org/x/text v0.22.0
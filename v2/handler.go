@@ -0,0 +1,143 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Validator is implemented by request types that check themselves after decoding
+type Validator interface {
+	Validate() error
+}
+
+// StatusError is an error carrying the HTTP status it is answered with by JSONHandler
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// WithStatus wraps err so JSONHandler answers it with status
+func WithStatus(err error, status int) error {
+	if err == nil {
+		return nil
+	}
+	return &StatusError{Status: status, Err: err}
+}
+
+// HandlerOptions configures JSONHandler
+type HandlerOptions struct {
+	// SuccessStatus is the status of successful responses, defaults to 200. With 204 the
+	// response is not written.
+	SuccessStatus int
+	// BindQuery sets fields of the request tagged `query:"name"` from the query string, see Bind
+	BindQuery bool
+	// BindPath sets fields tagged `path:"name"` from the path parameters, see Bind
+	BindPath bool
+	// PathParam returns a path parameter of the router in use, defaults to the path values of
+	// a Go 1.22 ServeMux
+	PathParam func(r *http.Request, name string) string
+	// ErrorStatus maps errors of the function without a StatusError to a status, errors it
+	// maps to 0 and unmapped errors are answered with 500 and logged, their message is not
+	// sent to the client
+	ErrorStatus func(err error) int
+	// Schema validates the request body before it is decoded, violations are answered with 422
+	Schema *Schema
+}
+
+// JSONHandler turns fn into an http.Handler. The request body is read into Req with
+// ReadJSON, so the size and unknown field settings of t apply, an empty body is allowed.
+// Path and query parameters are bound on top when enabled and Req is validated when it
+// implements Validator, then fn is called with the request context. Its response is sent
+// with WriteJSON, its error with ErrorJSON using the status of a StatusError or ErrorStatus.
+// Decoding and binding errors are answered with 400, a body that is too large with 413,
+// validation and schema errors with 422.
+func JSONHandler[Req, Resp any](t *Tools, fn func(ctx context.Context, req Req) (Resp, error), options ...HandlerOptions) http.Handler {
+	var opts HandlerOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.SuccessStatus == 0 {
+		opts.SuccessStatus = http.StatusOK
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if r.Body != nil && r.Body != http.NoBody {
+			// an empty body is only known once read, chunked requests have no Content-Length
+			if err := t.ReadJSON(w, r, &req, opts.Schema); err != nil && !errors.Is(err, errEmptyBody) {
+				var schemaErr *SchemaError
+				if errors.As(err, &schemaErr) {
+					_ = t.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+					return
+				}
+				// a StatusError carries its status, 413 for a body that is too large
+				_ = t.ErrorJSON(w, err)
+				return
+			}
+		}
+
+		var sources []bindSource
+		if opts.BindPath {
+			sources = append(sources, pathSource(r, opts.PathParam))
+		}
+		if opts.BindQuery {
+			sources = append(sources, querySource(r))
+		}
+		if len(sources) > 0 {
+			if err := bindValues(&req, sources...); err != nil {
+				_ = t.ErrorJSON(w, err)
+				return
+			}
+		}
+
+		if v, ok := any(&req).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				_ = t.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+				return
+			}
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			t.handlerError(w, r, err, opts)
+			return
+		}
+		if opts.SuccessStatus == http.StatusNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_ = t.WriteJSON(w, resp, opts.SuccessStatus)
+	})
+}
+
+func (t *Tools) handlerError(w http.ResponseWriter, r *http.Request, err error, opts HandlerOptions) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		_ = t.ErrorJSON(w, err, statusErr.Status)
+		return
+	}
+	if opts.ErrorStatus != nil {
+		if status := opts.ErrorStatus(err); status != 0 {
+			_ = t.ErrorJSON(w, err, status)
+			return
+		}
+	}
+
+	t.logger().ErrorContext(r.Context(), "handler failed",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("request_id", RequestIDFromContext(r.Context())),
+		slog.String("error", err.Error()),
+	)
+	_ = t.ErrorJSON(w, errors.New("internal server error"), http.StatusInternalServerError)
+}
@@ -0,0 +1,137 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createOrderRequest struct {
+	ShopID   int    `json:"-" path:"shop"`
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	DryRun   bool   `json:"-" query:"dry_run"`
+}
+
+func (r createOrderRequest) Validate() error {
+	if r.Quantity <= 0 {
+		return errors.New("quantity must be positive")
+	}
+	return nil
+}
+
+type createOrderResponse struct {
+	ID     string `json:"id"`
+	ShopID int    `json:"shop_id"`
+	DryRun bool   `json:"dry_run"`
+}
+
+var errOutOfStock = errors.New("item is out of stock")
+
+func createOrder(ctx context.Context, req createOrderRequest) (createOrderResponse, error) {
+	switch req.Item {
+	case "gone":
+		return createOrderResponse{}, WithStatus(errOutOfStock, http.StatusConflict)
+	case "mapped":
+		return createOrderResponse{}, errOutOfStock
+	case "broken":
+		return createOrderResponse{}, errors.New("database password is hunter2")
+	}
+	return createOrderResponse{ID: "o-1", ShopID: req.ShopID, DryRun: req.DryRun}, nil
+}
+
+var jsonHandlerTests = []struct {
+	name string
+	url  string
+	body string
+	// chunked sends the body without a Content-Length
+	chunked  bool
+	status   int
+	expected string
+}{
+	{name: "created", url: "/shops/7/orders?dry_run=true", body: `{"item":"tea","quantity":2}`, status: http.StatusCreated, expected: `{"id":"o-1","shop_id":7,"dry_run":true}`},
+	{name: "bad json", url: "/shops/7/orders", body: `{"item":`, status: http.StatusBadRequest},
+	{name: "unknown field", url: "/shops/7/orders", body: `{"item":"tea","quantity":1,"price":3}`, status: http.StatusBadRequest},
+	{name: "bad query", url: "/shops/7/orders?dry_run=maybe", body: `{"item":"tea","quantity":1}`, status: http.StatusBadRequest},
+	{name: "bad path", url: "/shops/seven/orders", body: `{"item":"tea","quantity":1}`, status: http.StatusBadRequest},
+	{name: "invalid", url: "/shops/7/orders", body: `{"item":"tea","quantity":0}`, status: http.StatusUnprocessableEntity},
+	{name: "empty body is validated", url: "/shops/7/orders", status: http.StatusUnprocessableEntity},
+	{name: "empty chunked body is validated", url: "/shops/7/orders", chunked: true, status: http.StatusUnprocessableEntity},
+	{name: "chunked body", url: "/shops/7/orders", body: `{"item":"tea","quantity":2}`, chunked: true, status: http.StatusCreated},
+	{name: "too large", url: "/shops/7/orders", body: `{"item":"` + strings.Repeat("t", 200) + `","quantity":2}`, status: http.StatusRequestEntityTooLarge},
+	{name: "status error", url: "/shops/7/orders", body: `{"item":"gone","quantity":1}`, status: http.StatusConflict, expected: `{"error":true,"message":"item is out of stock","data":null}`},
+	{name: "mapped error", url: "/shops/7/orders", body: `{"item":"mapped","quantity":1}`, status: http.StatusGone},
+	{name: "internal error", url: "/shops/7/orders", body: `{"item":"broken","quantity":1}`, status: http.StatusInternalServerError, expected: `{"error":true,"message":"internal server error","data":null}`},
+}
+
+func TestJSONHandler(t *testing.T) {
+	var logs bytes.Buffer
+	var testTools Tools
+	testTools.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	testTools.MaxJSONSize = 128
+
+	handler := JSONHandler(&testTools, createOrder, HandlerOptions{
+		SuccessStatus: http.StatusCreated,
+		BindQuery:     true,
+		BindPath:      true,
+		PathParam: func(r *http.Request, name string) string {
+			// stands in for the router, /shops/{shop}/orders
+			if name == "shop" {
+				return strings.Split(r.URL.Path, "/")[2]
+			}
+			return ""
+		},
+		ErrorStatus: func(err error) int {
+			if errors.Is(err, errOutOfStock) {
+				return http.StatusGone
+			}
+			return 0
+		},
+	})
+
+	for _, e := range jsonHandlerTests {
+		var body io.Reader = strings.NewReader(e.body)
+		if e.chunked {
+			body = io.MultiReader(body)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", e.url, body))
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d, got %d: %s", e.name, e.status, rr.Code, rr.Body.String())
+		}
+		if e.expected != "" && rr.Body.String() != e.expected {
+			t.Errorf("%s: body not as expected: %s", e.name, rr.Body.String())
+		}
+		if rr.Code >= 400 {
+			var payload JSONResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil || !payload.Error {
+				t.Errorf("%s: error not sent with ErrorJSON: %s", e.name, rr.Body.String())
+			}
+		}
+	}
+	if !strings.Contains(logs.String(), "hunter2") {
+		t.Error("internal error not logged")
+	}
+}
+
+func TestJSONHandlerNoContent(t *testing.T) {
+	var testTools Tools
+	called := false
+	handler := JSONHandler(&testTools, func(ctx context.Context, req struct{}) (any, error) {
+		called = ctx != nil
+		return nil, nil
+	}, HandlerOptions{SuccessStatus: http.StatusNoContent})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("DELETE", "/orders/1", nil))
+	if !called || rr.Code != http.StatusNoContent || rr.Body.Len() != 0 {
+		t.Errorf("response not as expected: %v %d %q", called, rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,426 @@
+package toolkit
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sortableAlphabet is URL safe and in ASCII order, so encoded ShortIDs sort like their bytes
+const sortableAlphabet = "-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+// ErrInvalidID is returned when an identifier cannot be parsed
+var ErrInvalidID = errors.New("invalid identifier")
+
+// idGenerator produces a millisecond timestamp and entropy that is strictly increasing for
+// ids created within the same millisecond: the previous entropy is incremented instead of
+// drawing new random bits, and the timestamp is borrowed from the next millisecond when the
+// entropy overflows. Clocks going backwards are treated like the same millisecond.
+type idGenerator struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	bits   int
+	lastMs int64
+	last   []byte
+}
+
+func newIDGenerator(bits int) *idGenerator {
+	return &idGenerator{bits: bits, lastMs: -1}
+}
+
+var (
+	uuidV7Generator  = newIDGenerator(74)
+	ulidGenerator    = newIDGenerator(80)
+	shortIDGenerator = newIDGenerator(48)
+)
+
+// next returns the timestamp and big endian entropy, the unused high bits are zero
+func (g *idGenerator) next() (int64, []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now
+	if g.now != nil {
+		now = g.now
+	}
+	ms := now().UnixMilli()
+
+	if ms <= g.lastMs && g.increment() {
+		ms = g.lastMs
+	} else {
+		if ms <= g.lastMs {
+			ms = g.lastMs + 1
+		}
+		g.last = make([]byte, (g.bits+7)/8)
+		randomBytes(g.last)
+		g.mask(g.last)
+	}
+	g.lastMs = ms
+
+	entropy := make([]byte, len(g.last))
+	copy(entropy, g.last)
+	return ms, entropy
+}
+
+// increment adds one to the last entropy and reports false when it overflowed
+func (g *idGenerator) increment() bool {
+	for i := len(g.last) - 1; i >= 0; i-- {
+		g.last[i]++
+		if g.last[i] != 0 {
+			break
+		}
+	}
+	unused := len(g.last)*8 - g.bits
+	overflow := g.last[0]>>(8-unused) != 0 || isZero(g.last)
+	return !overflow
+}
+
+func (g *idGenerator) mask(b []byte) {
+	unused := len(b)*8 - g.bits
+	b[0] &= 0xff >> unused
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func putMillis(dst []byte, ms int64) {
+	for i := 5; i >= 0; i-- {
+		dst[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+func millis(src []byte) time.Time {
+	var ms int64
+	for _, c := range src[:6] {
+		ms = ms<<8 | int64(c)
+	}
+	return time.UnixMilli(ms)
+}
+
+// UUID is an RFC 9562 universally unique identifier
+type UUID [16]byte
+
+// NewUUIDv4 returns a random UUID
+func (t *Tools) NewUUIDv4() UUID {
+	var u UUID
+	randomBytes(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// NewUUIDv7 returns a time ordered UUID, ids created by one process are strictly increasing
+func (t *Tools) NewUUIDv7() UUID {
+	return newUUIDv7(uuidV7Generator)
+}
+
+func newUUIDv7(g *idGenerator) UUID {
+	ms, entropy := g.next()
+
+	// 74 bits of entropy are split into the 12 bit rand_a and the 62 bit rand_b fields
+	hi := uint64(binary.BigEndian.Uint16(entropy[:2]))
+	lo := binary.BigEndian.Uint64(entropy[2:])
+	randA := hi<<2 | lo>>62
+	randB := lo & (1<<62 - 1)
+
+	var u UUID
+	putMillis(u[:6], ms)
+	binary.BigEndian.PutUint16(u[6:8], 0x7000|uint16(randA))
+	binary.BigEndian.PutUint64(u[8:], 0x8000000000000000|randB)
+	return u
+}
+
+// Version returns the version nibble, 4 or 7 for the UUIDs created here
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Time returns the creation time of a version 7 UUID and the zero time otherwise
+func (u UUID) Time() time.Time {
+	if u.Version() != 7 {
+		return time.Time{}
+	}
+	return millis(u[:])
+}
+
+// String returns the canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// MarshalText implements encoding.TextMarshaler, which JSON uses as well
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (u *UUID) UnmarshalText(text []byte) error {
+	parsed, err := ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
+// ParseUUID parses the canonical form of a UUID, with or without a urn:uuid: prefix
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	s = strings.TrimPrefix(strings.ToLower(s), "urn:uuid:")
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("%w: %q is not a uuid", ErrInvalidID, s)
+	}
+	h := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(u[:], []byte(h)); err != nil {
+		return u, fmt.Errorf("%w: %q is not a uuid", ErrInvalidID, s)
+	}
+	return u, nil
+}
+
+// IsUUID reports whether s is a valid UUID
+func IsUUID(s string) bool {
+	_, err := ParseUUID(s)
+	return err == nil
+}
+
+// ULID is a universally unique lexicographically sortable identifier: a 48 bit
+// millisecond timestamp followed by 80 bits of entropy, written in Crockford's base32
+type ULID [16]byte
+
+// NewULID returns a new ULID, ids created by one process are strictly increasing
+func (t *Tools) NewULID() ULID {
+	return newULID(ulidGenerator)
+}
+
+func newULID(g *idGenerator) ULID {
+	ms, entropy := g.next()
+	var u ULID
+	putMillis(u[:6], ms)
+	copy(u[6:], entropy)
+	return u
+}
+
+// Time returns the creation time of the ULID
+func (u ULID) Time() time.Time {
+	return millis(u[:])
+}
+
+// String returns the 26 character base32 form
+func (u ULID) String() string {
+	// 128 bits in 26 characters of 5 bits, the first character holds the top 3 bits
+	hi := binary.BigEndian.Uint64(u[:8])
+	lo := binary.BigEndian.Uint64(u[8:])
+	var b [26]byte
+	for i := 25; i >= 0; i-- {
+		b[i] = AlphabetCrockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b[:])
+}
+
+// MarshalText implements encoding.TextMarshaler, which JSON uses as well
+func (u ULID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (u *ULID) UnmarshalText(text []byte) error {
+	parsed, err := ParseULID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
+// ParseULID parses a ULID case-insensitively, accepting I and L for 1 and O for 0
+func ParseULID(s string) (ULID, error) {
+	var u ULID
+	if len(s) != 26 {
+		return u, fmt.Errorf("%w: %q is not a ulid", ErrInvalidID, s)
+	}
+
+	var hi, lo uint64
+	for i := 0; i < len(s); i++ {
+		v := crockfordValue(s[i])
+		if v < 0 || i == 0 && v > 7 {
+			return u, fmt.Errorf("%w: %q is not a ulid", ErrInvalidID, s)
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	binary.BigEndian.PutUint64(u[:8], hi)
+	binary.BigEndian.PutUint64(u[8:], lo)
+	return u, nil
+}
+
+// IsULID reports whether s is a valid ULID
+func IsULID(s string) bool {
+	_, err := ParseULID(s)
+	return err == nil
+}
+
+func crockfordValue(c byte) int {
+	switch c {
+	case 'i', 'I', 'l', 'L':
+		return 1
+	case 'o', 'O':
+		return 0
+	}
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	return strings.IndexByte(AlphabetCrockford, c)
+}
+
+// ShortID is a compact sortable identifier: a 48 bit millisecond timestamp followed by 48
+// bits of entropy, written as 16 URL safe characters that sort in creation order
+type ShortID [12]byte
+
+// NewShortID returns a new ShortID, ids created by one process are strictly increasing
+func (t *Tools) NewShortID() ShortID {
+	return newShortID(shortIDGenerator)
+}
+
+func newShortID(g *idGenerator) ShortID {
+	ms, entropy := g.next()
+	var id ShortID
+	putMillis(id[:6], ms)
+	copy(id[6:], entropy)
+	return id
+}
+
+// Time returns the creation time of the ShortID
+func (id ShortID) Time() time.Time {
+	return millis(id[:])
+}
+
+// String returns the 16 character form
+func (id ShortID) String() string {
+	var b [16]byte
+	for i := 0; i < 4; i++ {
+		// every 3 bytes become 4 characters of 6 bits
+		v := uint32(id[i*3])<<16 | uint32(id[i*3+1])<<8 | uint32(id[i*3+2])
+		for j := 3; j >= 0; j-- {
+			b[i*4+j] = sortableAlphabet[v&63]
+			v >>= 6
+		}
+	}
+	return string(b[:])
+}
+
+// MarshalText implements encoding.TextMarshaler, which JSON uses as well
+func (id ShortID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (id *ShortID) UnmarshalText(text []byte) error {
+	parsed, err := ParseShortID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// ParseShortID parses the 16 character form of a ShortID
+func ParseShortID(s string) (ShortID, error) {
+	var id ShortID
+	if len(s) != 16 {
+		return id, fmt.Errorf("%w: %q is not a short id", ErrInvalidID, s)
+	}
+	for i := 0; i < 4; i++ {
+		var v uint32
+		for j := 0; j < 4; j++ {
+			x := strings.IndexByte(sortableAlphabet, s[i*4+j])
+			if x < 0 {
+				return id, fmt.Errorf("%w: %q is not a short id", ErrInvalidID, s)
+			}
+			v = v<<6 | uint32(x)
+		}
+		id[i*3], id[i*3+1], id[i*3+2] = byte(v>>16), byte(v>>8), byte(v)
+	}
+	return id, nil
+}
+
+// IsShortID reports whether s is a valid ShortID
+func IsShortID(s string) bool {
+	_, err := ParseShortID(s)
+	return err == nil
+}
+
+// NamingStrategy turns the original name of an upload into the name it is stored under.
+// The name may contain slash separated directories, they are created as needed.
+type NamingStrategy func(t *Tools, originalName string) string
+
+// NameRandom is the default strategy, 25 random characters and the original extension
+func NameRandom(t *Tools, originalName string) string {
+	return fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(originalName))
+}
+
+// NameUUIDv4 names uploads with a random UUID and the original extension
+func NameUUIDv4(t *Tools, originalName string) string {
+	return t.NewUUIDv4().String() + filepath.Ext(originalName)
+}
+
+// NameUUIDv7 names uploads with a time ordered UUID and the original extension
+func NameUUIDv7(t *Tools, originalName string) string {
+	return t.NewUUIDv7().String() + filepath.Ext(originalName)
+}
+
+// NameULID names uploads with a ULID and the original extension
+func NameULID(t *Tools, originalName string) string {
+	return t.NewULID().String() + filepath.Ext(originalName)
+}
+
+// NameShortID names uploads with a ShortID and the original extension
+func NameShortID(t *Tools, originalName string) string {
+	return t.NewShortID().String() + filepath.Ext(originalName)
+}
+
+// newFileName names a file that is being renamed on upload
+func (t *Tools) newFileName(originalName string) string {
+	if t.NamingStrategy != nil {
+		return t.NamingStrategy(t, originalName)
+	}
+	return NameRandom(t, originalName)
+}
+
+// NameDatePartitioned puts the names of another strategy into year/month/day directories of
+// the current UTC date, e.g. "2024/05/17/01HXZ5J1C8B6A2V3W4X5Y6Z7Q8.png"
+func NameDatePartitioned(strategy NamingStrategy) NamingStrategy {
+	return func(t *Tools, originalName string) string {
+		return t.clock().UTC().Format("2006/01/02") + "/" + strategy(t, originalName)
+	}
+}
+
+func (t *Tools) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
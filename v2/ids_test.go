@@ -0,0 +1,200 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fixedIDGenerator(bits int, now time.Time) *idGenerator {
+	g := newIDGenerator(bits)
+	g.now = func() time.Time { return now }
+	return g
+}
+
+func TestTools_NewUUIDv4(t *testing.T) {
+	var testTools Tools
+	u := testTools.NewUUIDv4()
+	if u.Version() != 4 || u[8]&0xc0 != 0x80 {
+		t.Errorf("version or variant not as expected: %s", u)
+	}
+
+	parsed, err := ParseUUID(strings.ToUpper(u.String()))
+	if err != nil || parsed != u {
+		t.Errorf("round trip failed: %s, %v", parsed, err)
+	}
+}
+
+func TestTools_NewUUIDv7(t *testing.T) {
+	now := time.UnixMilli(1645557742000)
+	g := fixedIDGenerator(74, now)
+
+	var previous string
+	for i := 0; i < 1000; i++ {
+		u := newUUIDv7(g)
+		if u.Version() != 7 || u[8]&0xc0 != 0x80 {
+			t.Fatalf("version or variant not as expected: %s", u)
+		}
+		if !u.Time().Equal(now) && i == 0 {
+			t.Errorf("time not as expected: %s", u.Time())
+		}
+		if s := u.String(); s <= previous {
+			t.Fatalf("%s is not greater than %s", s, previous)
+		} else {
+			previous = s
+		}
+	}
+	if !strings.HasPrefix(previous, "017f22e2-79b0-7") {
+		t.Errorf("timestamp not encoded as expected: %s", previous)
+	}
+}
+
+func TestIDGenerator_Overflow(t *testing.T) {
+	now := time.UnixMilli(1000)
+	g := fixedIDGenerator(10, now)
+	g.next()
+
+	// force the entropy to its maximum, the next id has to move to the next millisecond
+	g.last = []byte{0x03, 0xff}
+	ms, entropy := g.next()
+	if ms != 1001 {
+		t.Errorf("expected the timestamp to move on, got %d", ms)
+	}
+	if entropy[0]&0xfc != 0 {
+		t.Errorf("unused entropy bits are set: %x", entropy)
+	}
+
+	// a clock going backwards keeps the order
+	g.now = func() time.Time { return time.UnixMilli(5) }
+	if ms, _ := g.next(); ms != 1001 {
+		t.Errorf("expected the last timestamp to be kept, got %d", ms)
+	}
+}
+
+func TestTools_NewULID(t *testing.T) {
+	// from the specification, 1469918176385 is 01ARYZ6S41
+	g := fixedIDGenerator(80, time.UnixMilli(1469918176385))
+
+	var ids []string
+	for i := 0; i < 1000; i++ {
+		u := newULID(g)
+		s := u.String()
+		if !strings.HasPrefix(s, "01ARYZ6S41") {
+			t.Fatalf("timestamp not encoded as expected: %s", s)
+		}
+		parsed, err := ParseULID(strings.ToLower(s))
+		if err != nil || parsed != u {
+			t.Fatalf("round trip failed for %s: %v", s, err)
+		}
+		ids = append(ids, s)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Error("ulids created within one millisecond are not sorted")
+	}
+
+	if _, err := ParseULID("8ZZZZZZZZZZZZZZZZZZZZZZZZZ"); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("overflowing ulid accepted: %v", err)
+	}
+}
+
+func TestTools_NewShortID(t *testing.T) {
+	g := fixedIDGenerator(48, time.UnixMilli(1700000000000))
+
+	var ids []string
+	for i := 0; i < 1000; i++ {
+		id := newShortID(g)
+		s := id.String()
+		if len(s) != 16 {
+			t.Fatalf("expected 16 characters, got %s", s)
+		}
+		parsed, err := ParseShortID(s)
+		if err != nil || parsed != id {
+			t.Fatalf("round trip failed for %s: %v", s, err)
+		}
+		ids = append(ids, s)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Error("short ids created within one millisecond are not sorted")
+	}
+
+	var testTools Tools
+	if !IsShortID(testTools.NewShortID().String()) || IsShortID("too short") {
+		t.Error("IsShortID not as expected")
+	}
+}
+
+var parseIDTests = []struct {
+	name  string
+	valid func(string) bool
+	s     string
+	ok    bool
+}{
+	{name: "uuid", valid: IsUUID, s: "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", ok: true},
+	{name: "uuid urn", valid: IsUUID, s: "urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6", ok: true},
+	{name: "uuid without dashes", valid: IsUUID, s: "f81d4fae7dec11d0a76500a0c91e6bf6", ok: false},
+	{name: "uuid bad hex", valid: IsUUID, s: "g81d4fae-7dec-11d0-a765-00a0c91e6bf6", ok: false},
+	{name: "ulid", valid: IsULID, s: "01ARZ3NDEKTSV4RRFFQ69G5FAV", ok: true},
+	{name: "ulid with u", valid: IsULID, s: "01ARZ3NDEKTSV4RRFFQ69G5FAU", ok: false},
+	{name: "short id bad char", valid: IsShortID, s: "0000000000000+00", ok: false},
+}
+
+func TestParseIDs(t *testing.T) {
+	for _, e := range parseIDTests {
+		if e.valid(e.s) != e.ok {
+			t.Errorf("%s: expected %v for %q", e.name, e.ok, e.s)
+		}
+	}
+}
+
+func TestIDs_JSON(t *testing.T) {
+	var testTools Tools
+	in := struct {
+		UUID    UUID    `json:"uuid"`
+		ULID    ULID    `json:"ulid"`
+		ShortID ShortID `json:"short_id"`
+	}{testTools.NewUUIDv7(), testTools.NewULID(), testTools.NewShortID()}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"uuid":"`+in.UUID.String()+`"`)) {
+		t.Errorf("uuid not marshalled as a string: %s", data)
+	}
+
+	out := in
+	out.UUID, out.ULID, out.ShortID = UUID{}, ULID{}, ShortID{}
+	if err := json.Unmarshal(data, &out); err != nil || out != in {
+		t.Errorf("round trip failed: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"uuid":"nope"}`), &out); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("expected ErrInvalidID, got %v", err)
+	}
+}
+
+func TestTools_UploadFilesNamingStrategy(t *testing.T) {
+	uploadDir := t.TempDir()
+
+	var testTools Tools
+	testTools.NamingStrategy = NameULID
+
+	files, err := testTools.UploadFiles(multipartRequest(t, "notes.txt", []byte("hello")), uploadDir)
+	if err != nil {
+		t.Fatalf("Error uploading file: %v", err)
+	}
+
+	name := files[0].NewFileName
+	if filepath.Ext(name) != ".txt" || !IsULID(strings.TrimSuffix(name, ".txt")) {
+		t.Errorf("file not named by the strategy: %s", name)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, name)); err != nil {
+		t.Errorf("file not stored: %v", err)
+	}
+}
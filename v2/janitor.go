@@ -0,0 +1,241 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StoredFile describes a file managed by a JanitorStore
+type StoredFile struct {
+	// Name is the slash separated path relative to the store
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// JanitorStore is where a Janitor finds and removes files, DirStore for a directory
+type JanitorStore interface {
+	List(ctx context.Context) ([]StoredFile, error)
+	Remove(ctx context.Context, name string) error
+}
+
+// DirStore is a JanitorStore for a directory tree such as an upload directory. Files and
+// directories starting with a dot are skipped, like the .resumable and .quarantine state
+// directories and the temporary files of uploads still being written, and directories left
+// empty by a removal are removed as well, which keeps date partitioned
+// uploads tidy.
+type DirStore struct {
+	Root string
+}
+
+// List walks the directory tree and returns every regular file
+func (d DirStore) List(ctx context.Context) ([]StoredFile, error) {
+	var files []StoredFile
+	err := filepath.WalkDir(d.Root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p != d.Root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(d.Root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, StoredFile{Name: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// Remove deletes a file and the directories it leaves empty, up to Root
+func (d DirStore) Remove(ctx context.Context, name string) error {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return errors.New("file is outside of the store")
+	}
+	p := filepath.Join(d.Root, filepath.FromSlash(name))
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+
+	root := filepath.Clean(d.Root)
+	for dir := filepath.Dir(p); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		// fails for directories that still have entries, which ends the clean up
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Janitor removes files from a store by age, size quota or name, once with Sweep or
+// periodically with Run
+type Janitor struct {
+	Store JanitorStore
+	// MaxAge removes files last modified longer ago than this
+	MaxAge time.Duration
+	// MaxTotalSize removes the least recently modified files until the store fits the quota
+	MaxTotalSize int64
+	// Patterns removes files whose name or slash separated path matches one of the globs
+	Patterns []string
+	// Interval between sweeps in Run, defaults to one hour
+	Interval time.Duration
+	// DryRun reports what would be removed without removing anything
+	DryRun bool
+	// OnSweep is called by Run with the report of every sweep
+	OnSweep func(report JanitorReport, err error)
+
+	now func() time.Time
+}
+
+// JanitorReport lists what a sweep removed, or would have removed in a dry run
+type JanitorReport struct {
+	Scanned      int
+	Removed      []StoredFile
+	RemovedBytes int64
+	DryRun       bool
+	// Errors holds the files that could not be removed, the sweep carries on without them
+	Errors []error
+}
+
+// NewJanitor returns a Janitor for a directory, typically an upload directory
+func (t *Tools) NewJanitor(dir string) *Janitor {
+	return &Janitor{Store: DirStore{Root: dir}}
+}
+
+func (j *Janitor) clock() time.Time {
+	if j.now != nil {
+		return j.now()
+	}
+	return time.Now()
+}
+
+// Sweep applies the patterns, MaxAge and MaxTotalSize, in that order, once
+func (j *Janitor) Sweep(ctx context.Context) (JanitorReport, error) {
+	report := JanitorReport{DryRun: j.DryRun}
+
+	files, err := j.Store.List(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Scanned = len(files)
+
+	// oldest first, which is the order the quota removes files in
+	sort.Slice(files, func(a, b int) bool {
+		if !files[a].ModTime.Equal(files[b].ModTime) {
+			return files[a].ModTime.Before(files[b].ModTime)
+		}
+		return files[a].Name < files[b].Name
+	})
+
+	now := j.clock()
+	var kept []StoredFile
+	var total int64
+	for _, f := range files {
+		if j.matches(f.Name) || j.MaxAge > 0 && now.Sub(f.ModTime) > j.MaxAge {
+			removed, err := j.remove(ctx, f, &report)
+			if err != nil {
+				return report, err
+			}
+			// a file that could not be removed still takes up space
+			if !removed {
+				total += f.Size
+			}
+			continue
+		}
+		kept = append(kept, f)
+		total += f.Size
+	}
+
+	if j.MaxTotalSize > 0 {
+		for _, f := range kept {
+			if total <= j.MaxTotalSize {
+				break
+			}
+			removed, err := j.remove(ctx, f, &report)
+			if err != nil {
+				return report, err
+			}
+			if removed {
+				total -= f.Size
+			}
+		}
+	}
+	return report, nil
+}
+
+func (j *Janitor) matches(name string) bool {
+	for _, pattern := range j.Patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// remove deletes one file and reports whether it did, a Store error is recorded in the report
+// and only a cancelled context stops the sweep
+func (j *Janitor) remove(ctx context.Context, f StoredFile, report *JanitorReport) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if !j.DryRun {
+		if err := j.Store.Remove(ctx, f.Name); err != nil {
+			report.Errors = append(report.Errors, err)
+			return false, nil
+		}
+	}
+	report.Removed = append(report.Removed, f)
+	report.RemovedBytes += f.Size
+	return true, nil
+}
+
+// Run sweeps immediately and then every Interval until ctx is cancelled
+func (j *Janitor) Run(ctx context.Context) error {
+	interval := j.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := j.Sweep(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if j.OnSweep != nil {
+			j.OnSweep(report, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// janitorFixture creates files named after their path with the given size, modified age ago
+func janitorFixture(t *testing.T, now time.Time, files map[string]struct {
+	size int
+	age  time.Duration
+}) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, f := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-f.age)
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func removedNames(report JanitorReport) string {
+	var names []string
+	for _, f := range report.Removed {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+var janitorTests = []struct {
+	name     string
+	janitor  Janitor
+	expected string
+}{
+	{name: "nothing to do", janitor: Janitor{}, expected: ""},
+	{name: "max age", janitor: Janitor{MaxAge: 36 * time.Hour}, expected: "2024/01/01/old.png,2024/01/02/older.tmp"},
+	{name: "pattern on base name", janitor: Janitor{Patterns: []string{"*.tmp"}}, expected: "2024/01/02/older.tmp"},
+	{name: "pattern on path", janitor: Janitor{Patterns: []string{"2024/01/03/*"}}, expected: "2024/01/03/new.png,2024/01/03/newer.png"},
+	{name: "quota removes oldest first", janitor: Janitor{MaxTotalSize: 250}, expected: "2024/01/01/old.png"},
+	{name: "quota after age", janitor: Janitor{MaxAge: 60 * time.Hour, MaxTotalSize: 150}, expected: "2024/01/01/old.png,2024/01/02/older.tmp,2024/01/03/new.png"},
+}
+
+func TestJanitor_Sweep(t *testing.T) {
+	now := time.Date(2024, 1, 4, 12, 0, 0, 0, time.UTC)
+	files := map[string]struct {
+		size int
+		age  time.Duration
+	}{
+		"2024/01/01/old.png":    {size: 100, age: 72 * time.Hour},
+		"2024/01/02/older.tmp":  {size: 50, age: 48 * time.Hour},
+		"2024/01/03/new.png":    {size: 100, age: 24 * time.Hour},
+		"2024/01/03/newer.png":  {size: 100, age: time.Hour},
+		".resumable/abc.part":   {size: 1000, age: 100 * time.Hour},
+		".quarantine/virus.exe": {size: 1000, age: 100 * time.Hour},
+	}
+
+	for _, e := range janitorTests {
+		root := janitorFixture(t, now, files)
+		j := e.janitor
+		j.Store = DirStore{Root: root}
+		j.now = func() time.Time { return now }
+
+		report, err := j.Sweep(context.Background())
+		if err != nil {
+			t.Fatalf("%s: sweep failed: %v", e.name, err)
+		}
+		if report.Scanned != 4 {
+			t.Errorf("%s: expected 4 files scanned, got %d", e.name, report.Scanned)
+		}
+		if got := removedNames(report); got != e.expected {
+			t.Errorf("%s: removed %q, expected %q", e.name, got, e.expected)
+		}
+		for _, f := range report.Removed {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(f.Name))); !os.IsNotExist(err) {
+				t.Errorf("%s: %s still exists", e.name, f.Name)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(root, ".resumable", "abc.part")); err != nil {
+			t.Errorf("%s: state directory touched: %v", e.name, err)
+		}
+	}
+}
+
+// failingRemoveStore fails to remove the file named fail
+type failingRemoveStore struct {
+	DirStore
+	fail string
+}
+
+func (s failingRemoveStore) Remove(ctx context.Context, name string) error {
+	if name == s.fail {
+		return errors.New("permission denied")
+	}
+	return s.DirStore.Remove(ctx, name)
+}
+
+func TestJanitor_SweepQuotaAfterFailedRemove(t *testing.T) {
+	now := time.Date(2024, 1, 4, 12, 0, 0, 0, time.UTC)
+	root := janitorFixture(t, now, map[string]struct {
+		size int
+		age  time.Duration
+	}{
+		"old.png":   {size: 100, age: 72 * time.Hour},
+		"older.tmp": {size: 50, age: 48 * time.Hour},
+		"new.png":   {size: 100, age: 24 * time.Hour},
+		"newer.png": {size: 100, age: time.Hour},
+	})
+	j := Janitor{Store: failingRemoveStore{DirStore: DirStore{Root: root}, fail: "old.png"}, MaxTotalSize: 250, now: func() time.Time { return now }}
+
+	report, err := j.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := removedNames(report); got != "new.png,older.tmp" || len(report.Errors) != 1 {
+		t.Errorf("removed %q with %d errors, expected new.png and older.tmp with 1 error", got, len(report.Errors))
+	}
+}
+
+func TestJanitor_SweepPrunesEmptyDirectories(t *testing.T) {
+	now := time.Now()
+	root := janitorFixture(t, now, map[string]struct {
+		size int
+		age  time.Duration
+	}{
+		"2024/01/01/a.png": {size: 1, age: 48 * time.Hour},
+		"2024/01/02/b.png": {size: 1, age: time.Hour},
+	})
+
+	var testTools Tools
+	j := testTools.NewJanitor(root)
+	j.MaxAge = 24 * time.Hour
+	if _, err := j.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "2024", "01", "01")); !os.IsNotExist(err) {
+		t.Error("empty day directory not removed")
+	}
+	if _, err := os.Stat(filepath.Join(root, "2024", "01", "02", "b.png")); err != nil {
+		t.Errorf("recent file removed: %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("root removed: %v", err)
+	}
+}
+
+func TestJanitor_SweepSkipsDotFiles(t *testing.T) {
+	now := time.Now()
+	root := janitorFixture(t, now, map[string]struct {
+		size int
+		age  time.Duration
+	}{
+		"a.png":            {size: 10, age: 48 * time.Hour},
+		".tmp-1":           {size: 10, age: 48 * time.Hour},
+		"2024/.writable-1": {size: 0, age: 48 * time.Hour},
+	})
+
+	j := Janitor{Store: DirStore{Root: root}, Patterns: []string{"*"}}
+	report, err := j.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 1 || removedNames(report) != "a.png" {
+		t.Errorf("report not as expected: %+v", report)
+	}
+	for _, name := range []string{".tmp-1", "2024/.writable-1"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s removed: %v", name, err)
+		}
+	}
+}
+
+func TestJanitor_SweepDryRun(t *testing.T) {
+	now := time.Now()
+	root := janitorFixture(t, now, map[string]struct {
+		size int
+		age  time.Duration
+	}{
+		"a.txt": {size: 10, age: 48 * time.Hour},
+	})
+
+	j := Janitor{Store: DirStore{Root: root}, MaxAge: time.Hour, DryRun: true}
+	report, err := j.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || len(report.Removed) != 1 || report.RemovedBytes != 10 {
+		t.Errorf("report not as expected: %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Errorf("dry run removed the file: %v", err)
+	}
+}
+
+func TestJanitor_Run(t *testing.T) {
+	root := t.TempDir()
+	j := Janitor{Store: DirStore{Root: root}, MaxAge: time.Hour, Interval: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sweeps := make(chan JanitorReport, 10)
+	j.OnSweep = func(report JanitorReport, err error) {
+		if err != nil {
+			t.Errorf("sweep failed: %v", err)
+		}
+		select {
+		case sweeps <- report:
+		default:
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- j.Run(ctx) }()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sweeps:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no sweep")
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run returned %v", err)
+	}
+}
+
+func TestTools_UploadFilesDatePartitioned(t *testing.T) {
+	uploadDir := t.TempDir()
+
+	var testTools Tools
+	testTools.NamingStrategy = NameDatePartitioned(NameULID)
+	testTools.now = func() time.Time { return time.Date(2024, 5, 17, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60)) }
+
+	files, err := testTools.UploadFiles(multipartRequest(t, "img.png", []byte("\x89PNG\r\n\x1a\n")), uploadDir)
+	if err != nil {
+		t.Fatalf("Error uploading file: %v", err)
+	}
+	// the partition is the UTC date
+	if !strings.HasPrefix(files[0].NewFileName, "2024/05/18/") || !strings.HasSuffix(files[0].NewFileName, ".png") {
+		t.Errorf("name not partitioned by date: %s", files[0].NewFileName)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(files[0].NewFileName))); err != nil {
+		t.Errorf("file not stored: %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a handler, the shape of Recover, RequestID, AccessLog and the handlers
+// returned by CORS and SecurityHeaders
+type Middleware func(next http.Handler) http.Handler
+
+// Chain wraps h with middleware, the first one is the outermost and sees requests first
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// RequestIDHeader is the header request ids are read from and written to
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the id RequestID stored for the request, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logger is Logger or the default slog logger
+func (t *Tools) logger() *slog.Logger {
+	if t.Logger != nil {
+		return t.Logger
+	}
+	return slog.Default()
+}
+
+// RequestID gives every request an id, stored in its context and sent back in the
+// X-Request-ID header. An id sent by the client or a proxy in front is kept when it is
+// printable and at most 128 characters long, otherwise a new ULID is generated, which sorts
+// by time in logs.
+func (t *Tools) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = t.NewULID().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder remembers the status and size of a response for logging and recovery
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+// Flush passes on flushes, so streamed responses still reach the client in time
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Recover turns a panic in next into a 500 response sent with ErrorJSON and logs it with its
+// stack trace. The panic value is not sent to the client. http.ErrAbortHandler is passed on,
+// it is the way to abort a response on purpose.
+func (t *Tools) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			t.logger().ErrorContext(r.Context(), "panic serving request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+				slog.String("panic", fmt.Sprint(v)),
+				slog.String("stack", string(debug.Stack())),
+			)
+			// once the response has started the status cannot be changed anymore
+			if rec.status == 0 {
+				_ = t.ErrorJSON(w, errors.New("internal server error"), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// AccessLog logs every request with Logger once it is served: method, path, status, bytes
+// written, duration, client address and the request id set by RequestID. Server errors are
+// logged at error level, client errors at warn level.
+func (t *Tools) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", rec.written),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if id := RequestIDFromContext(r.Context()); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		t.logger().LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// CORSOptions configures CORS
+type CORSOptions struct {
+	// AllowedOrigins are the origins allowed to call, "*" allows all and a single wildcard
+	// like "https://*.example.com" matches subdomains
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, HEAD, POST, PUT, PATCH and DELETE
+	AllowedMethods []string
+	// AllowedHeaders defaults to Content-Type, Authorization and X-Request-ID
+	AllowedHeaders []string
+	// ExposedHeaders are response headers scripts may read
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and authorization headers, the origin is then echoed
+	// back instead of "*"
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// CORS returns middleware answering preflight requests and adding the CORS headers for
+// allowed origins. Requests from other origins are served without them, so the browser
+// blocks the response.
+func (t *Tools) CORS(opts CORSOptions) Middleware {
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	headers := opts.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Content-Type", "Authorization", RequestIDHeader}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" || !originAllowed(opts.AllowedOrigins, origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if slices.Contains(opts.AllowedOrigins, "*") && !opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(opts.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			if opts.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func originAllowed(allowed []string, origin string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+		if strings.Contains(a, "*") {
+			if ok, _ := path.Match(strings.ToLower(a), strings.ToLower(origin)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SecurityHeaderOptions configures SecurityHeaders, empty fields get defaults suited to a
+// JSON API
+type SecurityHeaderOptions struct {
+	// ContentSecurityPolicy defaults to "default-src 'none'; frame-ancestors 'none'"
+	ContentSecurityPolicy string
+	// FrameOptions defaults to DENY
+	FrameOptions string
+	// ReferrerPolicy defaults to no-referrer
+	ReferrerPolicy string
+	// HSTSMaxAge sends Strict-Transport-Security on TLS requests when set
+	HSTSMaxAge time.Duration
+	// HSTSIncludeSubdomains extends Strict-Transport-Security to subdomains
+	HSTSIncludeSubdomains bool
+}
+
+// SecurityHeaders returns middleware setting X-Content-Type-Options, X-Frame-Options,
+// Referrer-Policy, Content-Security-Policy and, over TLS, Strict-Transport-Security. They are
+// set before next runs, so a handler can still change or delete them.
+func (t *Tools) SecurityHeaders(options ...SecurityHeaderOptions) Middleware {
+	var opts SecurityHeaderOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.ContentSecurityPolicy == "" {
+		opts.ContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	}
+	if opts.FrameOptions == "" {
+		opts.FrameOptions = "DENY"
+	}
+	if opts.ReferrerPolicy == "" {
+		opts.ReferrerPolicy = "no-referrer"
+	}
+	hsts := ""
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(opts.HSTSMaxAge.Seconds()))
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", opts.FrameOptions)
+			h.Set("Referrer-Policy", opts.ReferrerPolicy)
+			h.Set("Content-Security-Policy", opts.ContentSecurityPolicy)
+			if hsts != "" && r.TLS != nil {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
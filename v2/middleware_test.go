@@ -0,0 +1,196 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_RecoverAndRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	var testTools Tools
+	testTools.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("database is gone")
+	}), testTools.RequestID, testTools.Recover)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/orders", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rr.Code)
+	}
+	var payload JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil || !payload.Error || strings.Contains(payload.Message, "database") {
+		t.Errorf("error response not as expected: %s", rr.Body.String())
+	}
+	id := rr.Header().Get(RequestIDHeader)
+	if !IsULID(id) {
+		t.Errorf("no generated request id: %q", id)
+	}
+	if !strings.Contains(logs.String(), "database is gone") || !strings.Contains(logs.String(), id) {
+		t.Errorf("panic not logged with the request id: %s", logs.String())
+	}
+}
+
+func TestTools_RecoverAfterResponseStarted(t *testing.T) {
+	var testTools Tools
+	testTools.Logger = slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+
+	handler := testTools.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("partial"))
+		panic("late")
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusAccepted || rr.Body.String() != "partial" {
+		t.Errorf("started response changed: %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+var requestIDTests = []struct {
+	name     string
+	incoming string
+	kept     bool
+}{
+	{name: "none", incoming: "", kept: false},
+	{name: "from proxy", incoming: "edge-7f3a-42", kept: true},
+	{name: "control characters", incoming: "abc\ndef", kept: false},
+	{name: "too long", incoming: strings.Repeat("a", 129), kept: false},
+}
+
+func TestTools_RequestID(t *testing.T) {
+	var testTools Tools
+	for _, e := range requestIDTests {
+		var seen string
+		handler := testTools.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = RequestIDFromContext(r.Context())
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, e.incoming)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if seen == "" || seen != rr.Header().Get(RequestIDHeader) {
+			t.Errorf("%s: id not propagated: %q %q", e.name, seen, rr.Header().Get(RequestIDHeader))
+		}
+		if (seen == e.incoming) != e.kept {
+			t.Errorf("%s: incoming id kept %v, expected %v", e.name, seen == e.incoming, e.kept)
+		}
+	}
+}
+
+func TestTools_AccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	var testTools Tools
+	testTools.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.ErrorJSON(w, http.ErrMissingFile, http.StatusNotFound)
+	}), testTools.RequestID, testTools.AccessLog)
+
+	req := httptest.NewRequest("GET", "/files/a.pdf", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry not JSON: %v: %s", err, logs.String())
+	}
+	if entry["level"] != "WARN" || entry["method"] != "GET" || entry["path"] != "/files/a.pdf" ||
+		entry["status"] != float64(404) || entry["request_id"] != "req-1" || entry["bytes"].(float64) == 0 {
+		t.Errorf("log entry not as expected: %v", entry)
+	}
+}
+
+var corsTests = []struct {
+	name          string
+	opts          CORSOptions
+	method        string
+	origin        string
+	preflight     bool
+	allowOrigin   string
+	credentials   bool
+	reachesNext   bool
+	expectMethods bool
+}{
+	{name: "no origin", opts: CORSOptions{AllowedOrigins: []string{"*"}}, method: "GET", reachesNext: true},
+	{name: "any origin", opts: CORSOptions{AllowedOrigins: []string{"*"}}, method: "GET", origin: "https://a.test", allowOrigin: "*", reachesNext: true},
+	{name: "listed origin", opts: CORSOptions{AllowedOrigins: []string{"https://app.test"}}, method: "GET", origin: "https://app.test", allowOrigin: "https://app.test", reachesNext: true},
+	{name: "other origin", opts: CORSOptions{AllowedOrigins: []string{"https://app.test"}}, method: "GET", origin: "https://evil.test", reachesNext: true},
+	{name: "subdomain wildcard", opts: CORSOptions{AllowedOrigins: []string{"https://*.app.test"}}, method: "GET", origin: "https://eu.app.test", allowOrigin: "https://eu.app.test", reachesNext: true},
+	{name: "credentials echo origin", opts: CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}, method: "GET", origin: "https://a.test", allowOrigin: "https://a.test", credentials: true, reachesNext: true},
+	{name: "preflight", opts: CORSOptions{AllowedOrigins: []string{"*"}, MaxAge: time.Hour}, method: "OPTIONS", origin: "https://a.test", preflight: true, allowOrigin: "*", expectMethods: true},
+	{name: "preflight from other origin", opts: CORSOptions{AllowedOrigins: []string{"https://app.test"}}, method: "OPTIONS", origin: "https://evil.test", preflight: true},
+	{name: "plain options", opts: CORSOptions{AllowedOrigins: []string{"*"}}, method: "OPTIONS", origin: "https://a.test", allowOrigin: "*", reachesNext: true},
+}
+
+func TestTools_CORS(t *testing.T) {
+	var testTools Tools
+	for _, e := range corsTests {
+		reached := false
+		handler := testTools.CORS(e.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		}))
+		req := httptest.NewRequest(e.method, "/", nil)
+		if e.origin != "" {
+			req.Header.Set("Origin", e.origin)
+		}
+		if e.preflight {
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if reached != e.reachesNext {
+			t.Errorf("%s: handler reached %v", e.name, reached)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != e.allowOrigin {
+			t.Errorf("%s: allowed origin %q, expected %q", e.name, got, e.allowOrigin)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Credentials") == "true"; got != e.credentials {
+			t.Errorf("%s: credentials %v", e.name, got)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Methods") != ""; got != e.expectMethods {
+			t.Errorf("%s: allowed methods sent %v", e.name, got)
+		}
+		if e.expectMethods && (rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Max-Age") != "3600") {
+			t.Errorf("%s: preflight response not as expected: %d %v", e.name, rr.Code, rr.Header())
+		}
+	}
+}
+
+func TestTools_SecurityHeaders(t *testing.T) {
+	var testTools Tools
+	handler := testTools.SecurityHeaders(SecurityHeaderOptions{HSTSMaxAge: 365 * 24 * time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Del("X-Frame-Options")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" || rr.Header().Get("Content-Security-Policy") == "" || rr.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("headers not as expected: %v", rr.Header())
+	}
+	if rr.Header().Get("X-Frame-Options") != "" {
+		t.Error("handler could not remove a header")
+	}
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS sent over plain HTTP")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Strict-Transport-Security") != "max-age=31536000" {
+		t.Errorf("HSTS not as expected: %q", rr.Header().Get("Strict-Transport-Security"))
+	}
+}
@@ -0,0 +1,256 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOTP is returned when a one-time password does not verify
+var ErrInvalidOTP = errors.New("invalid one-time password")
+
+// OTPAlgorithm is the HMAC hash used for one-time passwords
+type OTPAlgorithm string
+
+// Supported one-time password algorithms
+const (
+	OTPSHA1   OTPAlgorithm = "SHA1"
+	OTPSHA256 OTPAlgorithm = "SHA256"
+	OTPSHA512 OTPAlgorithm = "SHA512"
+)
+
+// OTPOptions configures HOTP and TOTP, zero values use the defaults authenticator apps expect
+type OTPOptions struct {
+	// Digits of the code, 6 to 10, defaults to 6
+	Digits int
+	// Period of a TOTP time step in whole seconds, defaults to 30 seconds
+	Period time.Duration
+	// Algorithm defaults to OTPSHA1
+	Algorithm OTPAlgorithm
+	// Skew is how many steps (TOTP) or counters ahead (HOTP) are accepted, defaults to 1.
+	// Use a negative value to accept the exact step only.
+	Skew int
+}
+
+func otpOptions(options []OTPOptions) (OTPOptions, error) {
+	var o OTPOptions
+	if len(options) > 0 {
+		o = options[0]
+	}
+	if o.Digits == 0 {
+		o.Digits = 6
+	}
+	if o.Period == 0 {
+		o.Period = 30 * time.Second
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = OTPSHA1
+	}
+	if o.Skew == 0 {
+		o.Skew = 1
+	} else if o.Skew < 0 {
+		o.Skew = 0
+	}
+
+	if o.Digits < 6 || o.Digits > 10 {
+		return o, fmt.Errorf("otp digits must be between 6 and 10, got %d", o.Digits)
+	}
+	if o.Period < time.Second {
+		return o, errors.New("otp period must be at least one second")
+	}
+	// authenticator apps count in whole seconds, any other period never matches their codes
+	if o.Period%time.Second != 0 {
+		return o, fmt.Errorf("otp period must be a whole number of seconds, got %v", o.Period)
+	}
+	if _, err := o.hash(); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (o OTPOptions) hash() (func() hash.Hash, error) {
+	switch OTPAlgorithm(strings.ToUpper(string(o.Algorithm))) {
+	case OTPSHA1:
+		return sha1.New, nil
+	case OTPSHA256:
+		return sha256.New, nil
+	case OTPSHA512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported otp algorithm %q", o.Algorithm)
+	}
+}
+
+// NewOTPSecret returns a random base32 secret without padding, 20 bytes (160 bits) by default
+func (t *Tools) NewOTPSecret(size ...int) string {
+	n := 20
+	if len(size) > 0 && size[0] > 0 {
+		n = size[0]
+	}
+	b := make([]byte, n)
+	randomBytes(b)
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+}
+
+// decodeOTPSecret accepts base32 in any case, with or without padding and spaces
+func decodeOTPSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(s, "="))
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("otp secret is not valid base32")
+	}
+	return key, nil
+}
+
+// hotp computes the RFC 4226 value for a raw key
+func hotp(key []byte, counter uint64, o OTPOptions) string {
+	h, _ := o.hash()
+	mac := hmac.New(h, key)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	mod := uint64(1)
+	for i := 0; i < o.Digits; i++ {
+		mod *= 10
+	}
+	code := strconv.FormatUint(value%mod, 10)
+	return strings.Repeat("0", o.Digits-len(code)) + code
+}
+
+// HOTP returns the RFC 4226 one-time password for a base32 secret and counter
+func HOTP(secret string, counter uint64, options ...OTPOptions) (string, error) {
+	o, err := otpOptions(options)
+	if err != nil {
+		return "", err
+	}
+	key, err := decodeOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, counter, o), nil
+}
+
+// VerifyHOTP checks code against counter and the Skew counters after it. It returns the
+// counter to store for the next verification, one past the matching counter.
+func VerifyHOTP(code, secret string, counter uint64, options ...OTPOptions) (uint64, error) {
+	o, err := otpOptions(options)
+	if err != nil {
+		return counter, err
+	}
+	key, err := decodeOTPSecret(secret)
+	if err != nil {
+		return counter, err
+	}
+	for i := 0; i <= o.Skew; i++ {
+		c := counter + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(key, c, o)), []byte(code)) == 1 {
+			return c + 1, nil
+		}
+	}
+	return counter, ErrInvalidOTP
+}
+
+// TOTP returns the RFC 6238 one-time password for a base32 secret at the given time
+func TOTP(secret string, at time.Time, options ...OTPOptions) (string, error) {
+	o, err := otpOptions(options)
+	if err != nil {
+		return "", err
+	}
+	key, err := decodeOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpStep(at, o), o), nil
+}
+
+// VerifyTOTP checks code against the time step of at and Skew steps on either side. It
+// returns the matching step, callers should store it and reject codes for steps that are not
+// greater than the last one used to stop replays.
+func VerifyTOTP(code, secret string, at time.Time, options ...OTPOptions) (uint64, error) {
+	o, err := otpOptions(options)
+	if err != nil {
+		return 0, err
+	}
+	key, err := decodeOTPSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	step := totpStep(at, o)
+	for i := -o.Skew; i <= o.Skew; i++ {
+		if i < 0 && uint64(-i) > step {
+			continue
+		}
+		s := uint64(int64(step) + int64(i))
+		if subtle.ConstantTimeCompare([]byte(hotp(key, s, o)), []byte(code)) == 1 {
+			return s, nil
+		}
+	}
+	return 0, ErrInvalidOTP
+}
+
+func totpStep(at time.Time, o OTPOptions) uint64 {
+	seconds := at.Unix()
+	if seconds < 0 {
+		return 0
+	}
+	return uint64(seconds) / uint64(o.Period/time.Second)
+}
+
+// OTPAuthURI builds the otpauth://totp URI authenticator apps read from a QR code
+func OTPAuthURI(issuer, account, secret string, options ...OTPOptions) (string, error) {
+	o, err := otpOptions(options)
+	if err != nil {
+		return "", err
+	}
+	if account == "" {
+		return "", errors.New("otp account name is required")
+	}
+
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+
+	q := url.Values{}
+	q.Set("secret", strings.TrimRight(strings.ToUpper(secret), "="))
+	if issuer != "" {
+		q.Set("issuer", issuer)
+	}
+	q.Set("algorithm", strings.ToUpper(string(o.Algorithm)))
+	q.Set("digits", strconv.Itoa(o.Digits))
+	q.Set("period", strconv.Itoa(int(o.Period/time.Second)))
+
+	return "otpauth://totp/" + label + "?" + q.Encode(), nil
+}
+
+// RecoveryCodes returns n single use codes like "7K2QX-M9DFR" for when the authenticator is
+// lost. Store them with HashToken and compare with VerifyTokenHash.
+func (t *Tools) RecoveryCodes(n int) ([]string, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("number of recovery codes must not be negative, got %d", n)
+	}
+	codes := make([]string, n)
+	for i := range codes {
+		s := t.RandomString(10, AlphabetCrockford)
+		codes[i] = s[:5] + "-" + s[5:]
+	}
+	return codes, nil
+}
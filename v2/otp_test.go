@@ -0,0 +1,166 @@
+package toolkit
+
+import (
+	"encoding/base32"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func otpSecret(s string) string {
+	return base32.StdEncoding.EncodeToString([]byte(s))
+}
+
+// RFC 4226 appendix D
+var hotpVectors = []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+func TestHOTP(t *testing.T) {
+	secret := otpSecret("12345678901234567890")
+	for counter, expected := range hotpVectors {
+		code, err := HOTP(secret, uint64(counter))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("counter %d: expected %s, got %s", counter, expected, code)
+		}
+	}
+}
+
+func TestVerifyHOTP(t *testing.T) {
+	secret := otpSecret("12345678901234567890")
+
+	next, err := VerifyHOTP(hotpVectors[3], secret, 2)
+	if err != nil || next != 4 {
+		t.Errorf("code within the look-ahead window rejected: %d, %v", next, err)
+	}
+	if _, err := VerifyHOTP(hotpVectors[5], secret, 2); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("code beyond the window accepted: %v", err)
+	}
+	if _, err := VerifyHOTP(hotpVectors[3], secret, 2, OTPOptions{Skew: -1}); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("code accepted without a window: %v", err)
+	}
+}
+
+// RFC 6238 appendix B
+var totpVectors = []struct {
+	unix      int64
+	algorithm OTPAlgorithm
+	expected  string
+}{
+	{59, OTPSHA1, "94287082"},
+	{59, OTPSHA256, "46119246"},
+	{59, OTPSHA512, "90693936"},
+	{1111111109, OTPSHA1, "07081804"},
+	{1111111109, OTPSHA256, "68084774"},
+	{1111111109, OTPSHA512, "25091201"},
+	{1111111111, OTPSHA1, "14050471"},
+	{1111111111, OTPSHA256, "67062674"},
+	{1111111111, OTPSHA512, "99943326"},
+	{1234567890, OTPSHA1, "89005924"},
+	{1234567890, OTPSHA256, "91819424"},
+	{1234567890, OTPSHA512, "93441116"},
+	{2000000000, OTPSHA1, "69279037"},
+	{2000000000, OTPSHA256, "90698825"},
+	{2000000000, OTPSHA512, "38618901"},
+	{20000000000, OTPSHA1, "65353130"},
+	{20000000000, OTPSHA256, "77737706"},
+	{20000000000, OTPSHA512, "47863826"},
+}
+
+func TestTOTP(t *testing.T) {
+	secrets := map[OTPAlgorithm]string{
+		OTPSHA1:   otpSecret("12345678901234567890"),
+		OTPSHA256: otpSecret("12345678901234567890123456789012"),
+		OTPSHA512: otpSecret("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	for _, e := range totpVectors {
+		opts := OTPOptions{Digits: 8, Algorithm: e.algorithm}
+		code, err := TOTP(secrets[e.algorithm], time.Unix(e.unix, 0), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != e.expected {
+			t.Errorf("%d %s: expected %s, got %s", e.unix, e.algorithm, e.expected, code)
+		}
+
+		if _, err := VerifyTOTP(code, secrets[e.algorithm], time.Unix(e.unix+30, 0), opts); err != nil {
+			t.Errorf("%d %s: code from the previous step rejected: %v", e.unix, e.algorithm, err)
+		}
+		if _, err := VerifyTOTP(code, secrets[e.algorithm], time.Unix(e.unix+90, 0), opts); !errors.Is(err, ErrInvalidOTP) {
+			t.Errorf("%d %s: code outside the skew window accepted", e.unix, e.algorithm)
+		}
+	}
+}
+
+func TestOTPOptions(t *testing.T) {
+	secret := otpSecret("12345678901234567890")
+	for _, opts := range []OTPOptions{{Digits: 5}, {Digits: 11}, {Algorithm: "MD5"}, {Period: time.Millisecond}, {Period: 1500 * time.Millisecond}} {
+		if _, err := TOTP(secret, time.Now(), opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+	if _, err := TOTP("not base32!", time.Now()); err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+}
+
+func TestTools_NewOTPSecret(t *testing.T) {
+	var testTools Tools
+	secret := testTools.NewOTPSecret()
+	if len(secret) != 32 || strings.Contains(secret, "=") {
+		t.Errorf("secret not as expected: %s", secret)
+	}
+
+	code, err := TOTP(strings.ToLower(secret), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyTOTP(code, secret, time.Now()); err != nil {
+		t.Errorf("fresh code rejected: %v", err)
+	}
+}
+
+func TestOTPAuthURI(t *testing.T) {
+	uri, err := OTPAuthURI("Acme Co", "jane@example.com", "JBSWY3DPEHPK3PXP", OTPOptions{Digits: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Acme Co:jane@example.com" {
+		t.Errorf("label not as expected: %s", uri)
+	}
+	q := u.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Acme Co" || q.Get("digits") != "8" || q.Get("period") != "30" || q.Get("algorithm") != "SHA1" {
+		t.Errorf("parameters not as expected: %s", uri)
+	}
+}
+
+func TestTools_RecoveryCodes(t *testing.T) {
+	var testTools Tools
+	codes, err := testTools.RecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d: %v", len(codes), err)
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("code not as expected: %s", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %s", c)
+		}
+		seen[c] = true
+	}
+
+	if _, err := testTools.RecoveryCodes(-1); err == nil {
+		t.Error("expected an error for a negative number of codes")
+	}
+}
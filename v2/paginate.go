@@ -0,0 +1,311 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not issued with the cursor key
+var ErrInvalidCursor = errors.New("cursor is not valid")
+
+// PageOptions configures ReadPageRequest
+type PageOptions struct {
+	// DefaultLimit is the page size without a limit parameter, defaults to 20
+	DefaultLimit int
+	// MaxLimit caps the limit parameter, larger values are lowered to it, defaults to 100
+	MaxLimit int
+	// SortFields are the fields the sort parameter may use
+	SortFields []string
+	// DefaultSort applies without a sort parameter, e.g. "-created_at"
+	DefaultSort string
+	// Filters are the fields filter parameters may use with their allowed operators, a field
+	// without operators only allows eq
+	Filters map[string][]string
+	// CursorKey signs cursors, required for cursor pagination
+	CursorKey []byte
+}
+
+// SortField is a field of a sort expression
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Filter is a filter parameter, filter[status]=open or filter[price][gte]=10. The value of
+// the in operator is a comma separated list.
+type Filter struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// filterOperators are the operators a filter can use
+var filterOperators = []string{"eq", "ne", "lt", "lte", "gt", "gte", "in", "like"}
+
+// PageRequest is a list request parsed by ReadPageRequest
+type PageRequest struct {
+	// Page is 1 based, Offset the number of items before it
+	Page   int
+	Limit  int
+	Offset int
+	// Cursor is the verified payload of the cursor parameter, empty without one, see DecodeCursor
+	Cursor  json.RawMessage
+	Sort    []SortField
+	Filters []Filter
+}
+
+// DecodeCursor unmarshals the cursor payload into v
+func (p PageRequest) DecodeCursor(v any) error {
+	if len(p.Cursor) == 0 {
+		return errors.New("no cursor")
+	}
+	return json.Unmarshal(p.Cursor, v)
+}
+
+// ReadPageRequest parses the page, limit, cursor, sort and filter query parameters of a list
+// request, checking sort and filter fields against the options. Errors name the parameter and
+// are meant for ErrorJSON.
+func (t *Tools) ReadPageRequest(r *http.Request, opts PageOptions) (PageRequest, error) {
+	if opts.DefaultLimit <= 0 {
+		opts.DefaultLimit = 20
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = 100
+	}
+	q := r.URL.Query()
+	req := PageRequest{Page: 1, Limit: opts.DefaultLimit}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return req, errors.New(`query parameter "limit" must be a positive whole number`)
+		}
+		req.Limit = n
+	}
+	if req.Limit > opts.MaxLimit {
+		req.Limit = opts.MaxLimit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if q.Has("page") {
+			return req, errors.New(`query parameters "page" and "cursor" cannot be used together`)
+		}
+		payload, err := verifyCursor(opts.CursorKey, v)
+		if err != nil {
+			return req, err
+		}
+		req.Cursor = payload
+	} else if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return req, errors.New(`query parameter "page" must be a positive whole number`)
+		}
+		if n-1 > math.MaxInt32/req.Limit {
+			return req, errors.New(`query parameter "page" is out of range`)
+		}
+		req.Page = n
+	}
+	req.Offset = (req.Page - 1) * req.Limit
+
+	sortParam := q.Get("sort")
+	if sortParam == "" {
+		sortParam = opts.DefaultSort
+	}
+	sorting, err := parseSort(sortParam, opts.SortFields)
+	if err != nil {
+		return req, err
+	}
+	req.Sort = sorting
+
+	req.Filters, err = parseFilters(q, opts.Filters)
+	return req, err
+}
+
+func parseSort(s string, allowed []string) ([]SortField, error) {
+	var fields []SortField
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		f := SortField{Field: strings.TrimLeft(part, "+-"), Desc: strings.HasPrefix(part, "-")}
+		if !slices.Contains(allowed, f.Field) {
+			return nil, fmt.Errorf("query parameter \"sort\" cannot sort by %q", f.Field)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func parseFilters(q url.Values, allowed map[string][]string) ([]Filter, error) {
+	var filters []Filter
+	for key, values := range q {
+		rest, ok := strings.CutPrefix(key, "filter[")
+		if !ok {
+			continue
+		}
+		field, rest, ok := strings.Cut(rest, "]")
+		op := "eq"
+		if ok && rest != "" {
+			ok = strings.HasPrefix(rest, "[") && strings.HasSuffix(rest, "]") && len(rest) > 2
+			op = strings.Trim(rest, "[]")
+		}
+		if !ok || field == "" || !slices.Contains(filterOperators, op) {
+			return nil, fmt.Errorf("query parameter %q is not a valid filter", key)
+		}
+
+		ops, known := allowed[field]
+		if !known {
+			return nil, fmt.Errorf("query parameter %q cannot filter by %q", key, field)
+		}
+		if len(ops) == 0 {
+			ops = []string{"eq"}
+		}
+		if !slices.Contains(ops, op) {
+			return nil, fmt.Errorf("query parameter %q cannot use the %s operator", key, op)
+		}
+		filters = append(filters, Filter{Field: field, Operator: op, Value: values[0]})
+	}
+	// map order is random, a stable order keeps generated queries cacheable
+	sort.Slice(filters, func(a, b int) bool {
+		if filters[a].Field != filters[b].Field {
+			return filters[a].Field < filters[b].Field
+		}
+		return filters[a].Operator < filters[b].Operator
+	})
+	return filters, nil
+}
+
+// EncodeCursor returns an opaque cursor for v, typically the sort values of the last item of
+// a page, signed with the cursor key so clients cannot forge it
+func (t *Tools) EncodeCursor(opts PageOptions, v any) (string, error) {
+	if len(opts.CursorKey) == 0 {
+		return "", errors.New("no cursor key")
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + cursorSignature(opts.CursorKey, payload), nil
+}
+
+func cursorSignature(key, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func verifyCursor(key []byte, cursor string) (json.RawMessage, error) {
+	encoded, sig, ok := strings.Cut(cursor, ".")
+	if !ok || len(key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(cursorSignature(key, payload))) || !json.Valid(payload) {
+		return nil, ErrInvalidCursor
+	}
+	return payload, nil
+}
+
+// PageResult describes the page being written by WritePage
+type PageResult struct {
+	// Total is the number of items in the whole list, nil when it is not known
+	Total *int64
+	// HasMore tells whether a next page exists when Total is nil
+	HasMore bool
+	// NextCursor and PrevCursor link the pages in cursor pagination, see EncodeCursor
+	NextCursor string
+	PrevCursor string
+}
+
+// Pagination is the pagination part of a PageEnvelope, links are relative to the request
+type Pagination struct {
+	Page  int    `json:"page,omitempty"`
+	Limit int    `json:"limit"`
+	Total *int64 `json:"total,omitempty"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// PageEnvelope is the JSONResponse of a list, with the pagination next to the data
+type PageEnvelope struct {
+	JSONResponse
+	Pagination Pagination `json:"pagination"`
+}
+
+// WritePage writes data, one page of a list, with WriteJSON in a PageEnvelope. The links to
+// the first, previous, next and last pages are also sent in an RFC 8288 Link header. Page
+// links keep the other query parameters of the request, so filters and sorting carry over.
+func (t *Tools) WritePage(w http.ResponseWriter, r *http.Request, req PageRequest, data any, result PageResult, status ...int) error {
+	statusCode := http.StatusOK
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+
+	p := Pagination{Limit: req.Limit, Total: result.Total}
+
+	if len(req.Cursor) > 0 || result.NextCursor != "" || result.PrevCursor != "" {
+		if result.NextCursor != "" {
+			p.Next = pageLink(r, "cursor", result.NextCursor)
+		}
+		if result.PrevCursor != "" {
+			p.Prev = pageLink(r, "cursor", result.PrevCursor)
+		}
+		p.First = pageLink(r, "cursor", "")
+	} else {
+		p.Page = req.Page
+		p.First = pageLink(r, "page", "1")
+		if req.Page > 1 {
+			p.Prev = pageLink(r, "page", strconv.Itoa(req.Page-1))
+		}
+		if result.Total != nil {
+			last := max(1, int((*result.Total+int64(req.Limit)-1)/int64(req.Limit)))
+			p.Last = pageLink(r, "page", strconv.Itoa(last))
+			if req.Page < last {
+				p.Next = pageLink(r, "page", strconv.Itoa(req.Page+1))
+			}
+		} else if result.HasMore {
+			p.Next = pageLink(r, "page", strconv.Itoa(req.Page+1))
+		}
+	}
+
+	var links []string
+	for _, l := range []struct{ rel, href string }{{"first", p.First}, {"prev", p.Prev}, {"next", p.Next}, {"last", p.Last}} {
+		if l.href != "" {
+			links = append(links, fmt.Sprintf("<%s>; rel=%q", l.href, l.rel))
+		}
+	}
+	var headers http.Header
+	if len(links) > 0 {
+		headers = http.Header{"Link": {strings.Join(links, ", ")}}
+	}
+
+	envelope := PageEnvelope{JSONResponse: JSONResponse{Data: data}, Pagination: p}
+	return t.WriteJSON(w, envelope, statusCode, headers)
+}
+
+// pageLink is the request URL with param set to value, or removed for an empty value, and
+// the other pagination parameter removed
+func pageLink(r *http.Request, param, value string) string {
+	q := r.URL.Query()
+	q.Del("page")
+	q.Del("cursor")
+	if value != "" {
+		q.Set(param, value)
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
@@ -0,0 +1,193 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var pageOptions = PageOptions{
+	MaxLimit:    50,
+	SortFields:  []string{"created_at", "name"},
+	DefaultSort: "-created_at",
+	Filters:     map[string][]string{"status": nil, "price": {"gte", "lte"}},
+	CursorKey:   []byte("cursor secret"),
+}
+
+var readPageRequestTests = []struct {
+	name          string
+	url           string
+	expected      PageRequest
+	errorExpected string
+}{
+	{
+		name:     "defaults",
+		url:      "/orders",
+		expected: PageRequest{Page: 1, Limit: 20, Sort: []SortField{{Field: "created_at", Desc: true}}},
+	},
+	{
+		name: "page, sort and filters",
+		url:  "/orders?page=3&limit=10&sort=name,-created_at&filter[status]=open&filter[price][gte]=10&filter[price][lte]=20",
+		expected: PageRequest{
+			Page: 3, Limit: 10, Offset: 20,
+			Sort: []SortField{{Field: "name"}, {Field: "created_at", Desc: true}},
+			Filters: []Filter{
+				{Field: "price", Operator: "gte", Value: "10"},
+				{Field: "price", Operator: "lte", Value: "20"},
+				{Field: "status", Operator: "eq", Value: "open"},
+			},
+		},
+	},
+	{
+		name:     "limit is capped",
+		url:      "/orders?limit=1000&sort=name",
+		expected: PageRequest{Page: 1, Limit: 50, Sort: []SortField{{Field: "name"}}},
+	},
+	{name: "bad page", url: "/orders?page=0", errorExpected: `query parameter "page" must be a positive whole number`},
+	{name: "huge page", url: "/orders?page=999999999", errorExpected: `query parameter "page" is out of range`},
+	{name: "bad limit", url: "/orders?limit=ten", errorExpected: `query parameter "limit" must be a positive whole number`},
+	{name: "sort not allowed", url: "/orders?sort=password", errorExpected: `query parameter "sort" cannot sort by "password"`},
+	{name: "filter not allowed", url: "/orders?filter[owner]=me", errorExpected: `query parameter "filter[owner]" cannot filter by "owner"`},
+	{name: "operator not allowed", url: "/orders?filter[status][ne]=open", errorExpected: `query parameter "filter[status][ne]" cannot use the ne operator`},
+	{name: "bad filter", url: "/orders?filter[price][gte=1", errorExpected: `query parameter "filter[price][gte" is not a valid filter`},
+	{name: "cursor and page", url: "/orders?page=2&cursor=x", errorExpected: `query parameters "page" and "cursor" cannot be used together`},
+	{name: "forged cursor", url: "/orders?cursor=eyJpZCI6NX0.AAAAAAAAAAAAAAAAAAAAAA", errorExpected: ErrInvalidCursor.Error()},
+}
+
+func TestTools_ReadPageRequest(t *testing.T) {
+	var testTools Tools
+	for _, e := range readPageRequestTests {
+		got, err := testTools.ReadPageRequest(httptest.NewRequest("GET", e.url, nil), pageOptions)
+		if e.errorExpected != "" {
+			if err == nil || err.Error() != e.errorExpected {
+				t.Errorf("%s: expected error %q, got %v", e.name, e.errorExpected, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, e.expected) {
+			t.Errorf("%s: got %+v", e.name, got)
+		}
+	}
+}
+
+func TestTools_EncodeCursor(t *testing.T) {
+	var testTools Tools
+	type position struct {
+		CreatedAt string `json:"c"`
+		ID        int    `json:"i"`
+	}
+
+	cursor, err := testTools.EncodeCursor(pageOptions, position{CreatedAt: "2024-05-01", ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := testTools.ReadPageRequest(httptest.NewRequest("GET", "/orders?cursor="+cursor, nil), pageOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got position
+	if err := req.DecodeCursor(&got); err != nil || got.ID != 42 {
+		t.Errorf("cursor not decoded: %+v %v", got, err)
+	}
+
+	otherKey := pageOptions
+	otherKey.CursorKey = []byte("another secret")
+	if _, err := testTools.ReadPageRequest(httptest.NewRequest("GET", "/orders?cursor="+cursor, nil), otherKey); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor accepted with another key: %v", err)
+	}
+	if _, err := testTools.EncodeCursor(PageOptions{}, position{}); err == nil {
+		t.Error("expected an error without a cursor key")
+	}
+}
+
+var writePageTests = []struct {
+	name       string
+	url        string
+	result     PageResult
+	pagination Pagination
+	link       string
+}{
+	{
+		name:       "middle page",
+		url:        "/orders?page=2&limit=10&filter[status]=open",
+		result:     PageResult{Total: ptr(int64(35))},
+		pagination: Pagination{Page: 2, Limit: 10, Total: ptr(int64(35)), First: "/orders?filter%5Bstatus%5D=open&limit=10&page=1", Prev: "/orders?filter%5Bstatus%5D=open&limit=10&page=1", Next: "/orders?filter%5Bstatus%5D=open&limit=10&page=3", Last: "/orders?filter%5Bstatus%5D=open&limit=10&page=4"},
+		link:       `</orders?filter%5Bstatus%5D=open&limit=10&page=1>; rel="first", </orders?filter%5Bstatus%5D=open&limit=10&page=1>; rel="prev", </orders?filter%5Bstatus%5D=open&limit=10&page=3>; rel="next", </orders?filter%5Bstatus%5D=open&limit=10&page=4>; rel="last"`,
+	},
+	{
+		name:       "last page",
+		url:        "/orders?page=4&limit=10",
+		result:     PageResult{Total: ptr(int64(35))},
+		pagination: Pagination{Page: 4, Limit: 10, Total: ptr(int64(35)), First: "/orders?limit=10&page=1", Prev: "/orders?limit=10&page=3", Last: "/orders?limit=10&page=4"},
+		link:       `</orders?limit=10&page=1>; rel="first", </orders?limit=10&page=3>; rel="prev", </orders?limit=10&page=4>; rel="last"`,
+	},
+	{
+		name:       "unknown total",
+		url:        "/orders",
+		result:     PageResult{HasMore: true},
+		pagination: Pagination{Page: 1, Limit: 20, First: "/orders?page=1", Next: "/orders?page=2"},
+		link:       `</orders?page=1>; rel="first", </orders?page=2>; rel="next"`,
+	},
+	{
+		name:       "unknown total on the last page",
+		url:        "/orders?page=2",
+		result:     PageResult{},
+		pagination: Pagination{Page: 2, Limit: 20, First: "/orders?page=1", Prev: "/orders?page=1"},
+		link:       `</orders?page=1>; rel="first", </orders?page=1>; rel="prev"`,
+	},
+	{
+		name:       "empty list",
+		url:        "/orders",
+		result:     PageResult{Total: ptr(int64(0))},
+		pagination: Pagination{Page: 1, Limit: 20, Total: ptr(int64(0)), First: "/orders?page=1", Last: "/orders?page=1"},
+		link:       `</orders?page=1>; rel="first", </orders?page=1>; rel="last"`,
+	},
+	{
+		name:       "cursor",
+		url:        "/orders?sort=name",
+		result:     PageResult{NextCursor: "abc.def"},
+		pagination: Pagination{Limit: 20, First: "/orders?sort=name", Next: "/orders?cursor=abc.def&sort=name"},
+		link:       `</orders?sort=name>; rel="first", </orders?cursor=abc.def&sort=name>; rel="next"`,
+	},
+}
+
+func TestTools_WritePage(t *testing.T) {
+	var testTools Tools
+	for _, e := range writePageTests {
+		r := httptest.NewRequest("GET", e.url, nil)
+		req, err := testTools.ReadPageRequest(r, pageOptions)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		rr := httptest.NewRecorder()
+		if err := testTools.WritePage(rr, r, req, []string{"a", "b"}, e.result); err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if link := rr.Header().Get("Link"); link != e.link {
+			t.Errorf("%s: wrong Link header: %s", e.name, link)
+		}
+
+		var payload struct {
+			JSONResponse
+			Data       []string   `json:"data"`
+			Pagination Pagination `json:"pagination"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if payload.Error || len(payload.Data) != 2 || !reflect.DeepEqual(payload.Pagination, e.pagination) {
+			t.Errorf("%s: body not as expected: %s", e.name, rr.Body.String())
+		}
+		if !strings.HasPrefix(rr.Body.String(), `{"error":false,`) {
+			t.Errorf("%s: envelope not a JSONResponse: %s", e.name, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,720 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is one operation of an RFC 6902 JSON Patch
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch is an RFC 6902 JSON Patch document
+type JSONPatch []PatchOperation
+
+// PatchError is the failure of one operation of a JSON Patch
+type PatchError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("patch operation %d (%s %q): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+var patchOps = []string{"add", "remove", "replace", "move", "copy", "test"}
+
+// ParseJSONPatch decodes a JSON Patch and checks every operation is complete and its paths
+// are JSON Pointers
+func ParseJSONPatch(data []byte) (JSONPatch, error) {
+	var patch JSONPatch
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, errors.New("request body must be a JSON Patch array of operations")
+	}
+	for i, op := range patch {
+		fail := func(msg string) error {
+			return &PatchError{Index: i, Op: op.Op, Path: op.Path, Err: errors.New(msg)}
+		}
+		if !slices.Contains(patchOps, op.Op) {
+			return nil, fail("unknown operation")
+		}
+		if _, err := parsePointer(op.Path); err != nil {
+			return nil, fail(err.Error())
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fail("value is missing")
+			}
+		case "move", "copy":
+			if _, err := parsePointer(op.From); err != nil {
+				return nil, fail("from " + err.Error())
+			}
+		}
+	}
+	return patch, nil
+}
+
+// Apply applies the patch to the JSON document doc and returns the patched document. The
+// patch is applied as a whole: when an operation fails, including a failed test, the error
+// is a PatchError and nothing is returned.
+func (p JSONPatch) Apply(doc []byte) ([]byte, error) {
+	root, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range p {
+		if root, err = applyOperation(root, op); err != nil {
+			return nil, &PatchError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+	return json.Marshal(root)
+}
+
+func applyOperation(root any, op PatchOperation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if op.Value != nil {
+		if value, err = decodeJSONValue(op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return addValue(root, path, value)
+	case "remove":
+		root, _, err = removeValue(root, path)
+		return root, err
+	case "replace":
+		if _, err := getValue(root, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		return modifyParent(root, path, func(parent any, key string) (any, error) {
+			switch c := parent.(type) {
+			case map[string]any:
+				c[key] = value
+				return c, nil
+			case []any:
+				i, _ := arrayIndex(key, len(c)-1)
+				c[i] = value
+				return c, nil
+			}
+			return nil, errPathNotFound
+		})
+	case "move", "copy":
+		from, _ := parsePointer(op.From)
+		if op.Op == "move" && len(from) < len(path) && slices.Equal(from, path[:len(from)]) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		if op.Op == "move" {
+			root, value, err = removeValue(root, from)
+		} else if value, err = getValue(root, from); err == nil {
+			value = deepCopyJSON(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("from %q: %w", op.From, err)
+		}
+		return addValue(root, path, value)
+	case "test":
+		current, err := getValue(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, value) {
+			return nil, errors.New("test failed, the value is different")
+		}
+		return root, nil
+	}
+	return nil, errors.New("unknown operation")
+}
+
+var errPathNotFound = errors.New("path does not exist")
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("path must be empty or start with /")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// escapePointerToken escapes a key for use in a JSON Pointer
+func escapePointerToken(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// arrayIndex parses an array index of a JSON Pointer that may be at most max
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d is out of range", i)
+	}
+	return i, nil
+}
+
+func getValue(root any, path []string) (any, error) {
+	node := root
+	for _, token := range path {
+		switch c := node.(type) {
+		case map[string]any:
+			v, ok := c[token]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			node = v
+		case []any:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = c[i]
+		default:
+			return nil, errPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// modifyParent calls fn with the container holding the last token of path and stores the
+// container it returns, as inserting into an array creates a new slice
+func modifyParent(node any, path []string, fn func(parent any, key string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+	switch c := node.(type) {
+	case map[string]any:
+		child, ok := c[path[0]]
+		if !ok {
+			return nil, errPathNotFound
+		}
+		child, err := modifyParent(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[path[0]] = child
+		return c, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := modifyParent(c[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = child
+		return c, nil
+	}
+	return nil, errPathNotFound
+}
+
+func addValue(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return modifyParent(root, path, func(parent any, key string) (any, error) {
+		switch c := parent.(type) {
+		case map[string]any:
+			c[key] = value
+			return c, nil
+		case []any:
+			if key == "-" {
+				return append(c, value), nil
+			}
+			i, err := arrayIndex(key, len(c))
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(c, i, value), nil
+		}
+		return nil, errPathNotFound
+	})
+}
+
+func removeValue(root any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed any
+	root, err := modifyParent(root, path, func(parent any, key string) (any, error) {
+		switch c := parent.(type) {
+		case map[string]any:
+			v, ok := c[key]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			removed = v
+			delete(c, key)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(key, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return slices.Delete(c, i, i+1), nil
+		}
+		return nil, errPathNotFound
+	})
+	return root, removed, err
+}
+
+// decodeJSONValue decodes a single JSON value keeping numbers exact
+func decodeJSONValue(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, errors.New("document contains badly-formed JSON")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("document must only contain a single JSON value")
+	}
+	return v, nil
+}
+
+func deepCopyJSON(v any) any {
+	switch c := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(c))
+		for k, e := range c {
+			m[k] = deepCopyJSON(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(c))
+		for i, e := range c {
+			s[i] = deepCopyJSON(e)
+		}
+		return s
+	}
+	return v
+}
+
+// jsonEqual compares decoded JSON values the way RFC 6902 tests them, numbers by value
+func jsonEqual(a, b any) bool {
+	if na, ok := a.(json.Number); ok {
+		nb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := na.Float64()
+		fb, errB := nb.Float64()
+		return errA == nil && errB == nil && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// MergePatch applies the RFC 7396 JSON Merge Patch patch to the JSON document doc: members of
+// patch objects replace those of doc recursively and null members remove them
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decodeJSONValue(patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValues(target, p))
+}
+
+func mergeValues(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergeValues(t[k], v)
+	}
+	return t
+}
+
+// ReadPatch reads the body of a PATCH request and applies it to the value target points to.
+// A body of type application/json-patch+json is a JSON Patch, application/merge-patch+json
+// and application/json bodies are Merge Patches. The body is limited and checked like ReadJSON.
+func (t *Tools) ReadPatch(w http.ResponseWriter, r *http.Request, target any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json-patch+json", "application/merge-patch+json", "application/json", "":
+	default:
+		return errors.New("request body must be a JSON Patch or a JSON Merge Patch")
+	}
+
+	body, err := t.readJSONBody(w, r)
+	if err != nil {
+		return err
+	}
+	if err := t.StrictJSON.check(body); err != nil {
+		return err
+	}
+	if mediaType == "application/json-patch+json" {
+		patch, err := ParseJSONPatch(body)
+		if err != nil {
+			return err
+		}
+		return t.ApplyJSONPatch(patch, target)
+	}
+	return t.ApplyMergePatch(body, target)
+}
+
+// ApplyJSONPatch applies patch to the value target points to. Unless AllowUnknownFields is
+// set, every path must name a field of target by its JSON name. Fields that are not part of
+// the JSON representation of target, like those tagged `json:"-"`, are kept.
+func (t *Tools) ApplyJSONPatch(patch JSONPatch, target any) error {
+	if !t.AllowUnknownFields {
+		typ := reflect.TypeOf(target)
+		for i, op := range patch {
+			for _, pointer := range []string{op.Path, op.From} {
+				if pointer == "" {
+					continue
+				}
+				path, _ := parsePointer(pointer)
+				if err := checkJSONPath(typ, path); err != nil {
+					return &PatchError{Index: i, Op: op.Op, Path: op.Path, Err: fmt.Errorf("%q %w", pointer, err)}
+				}
+			}
+		}
+	}
+	return t.patchValue(target, patch.Apply)
+}
+
+// ApplyMergePatch applies the JSON Merge Patch patch to the value target points to. Unless
+// AllowUnknownFields is set, every member of patch must name a field of target by its JSON
+// name. Fields that are not part of the JSON representation of target are kept.
+func (t *Tools) ApplyMergePatch(patch []byte, target any) error {
+	p, err := decodeJSONValue(patch)
+	if err != nil {
+		return err
+	}
+	if _, ok := p.(map[string]any); !ok {
+		return errors.New("merge patch must be a JSON object")
+	}
+	if !t.AllowUnknownFields {
+		if err := checkMergeFields(reflect.TypeOf(target), p, ""); err != nil {
+			return err
+		}
+	}
+	return t.patchValue(target, func(doc []byte) ([]byte, error) {
+		return MergePatch(doc, patch)
+	})
+}
+
+// patchValue encodes target, patches the document with apply and decodes the result back
+func (t *Tools) patchValue(target any, apply func(doc []byte) ([]byte, error)) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return errors.New("patch target must be a non-nil pointer")
+	}
+	doc, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	patched, err := apply(doc)
+	if err != nil {
+		return err
+	}
+
+	// decode into a copy without its JSON fields, so removed fields end up zero
+	result := reflect.New(v.Elem().Type())
+	result.Elem().Set(v.Elem())
+	clearJSONFields(result.Elem())
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	if !t.AllowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(result.Interface()); err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		if errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "" {
+			return fmt.Errorf("patch sets an invalid value for the %q field", unmarshalTypeError.Field)
+		}
+		return fmt.Errorf("patch result cannot be decoded: %w", err)
+	}
+	v.Elem().Set(result.Elem())
+	return nil
+}
+
+// clearJSONFields zeroes the fields of a struct that encoding/json reads and writes
+func clearJSONFields(v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		v.SetZero()
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			clearJSONFields(v.Field(i))
+			continue
+		}
+		if field.IsExported() {
+			v.Field(i).SetZero()
+		}
+	}
+}
+
+// jsonStructField is a field of a struct as encoding/json sees it, index is the path through
+// embedded structs
+type jsonStructField struct {
+	name   string
+	tagged bool
+	index  []int
+	typ    reflect.Type
+}
+
+// jsonStructFields lists the fields encoding/json decodes into for struct type t, following
+// its rules for embedded structs: the shallowest field of a name wins, at the same depth a
+// single tagged field wins and otherwise the name is dropped
+func jsonStructFields(t reflect.Type) []jsonStructField {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var fields []jsonStructField
+	next := []embedded{{typ: t}}
+	count := map[reflect.Type]int{t: 1}
+	visited := map[reflect.Type]bool{}
+	for len(next) > 0 {
+		current := next
+		currentCount := count
+		next, count = nil, map[reflect.Type]int{}
+
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				ft := sf.Type
+				if sf.Anonymous && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if !sf.IsExported() && !(sf.Anonymous && ft.Kind() == reflect.Struct) {
+					continue
+				}
+				tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+				if tag == "-" {
+					continue
+				}
+				index := append(slices.Clone(e.index), i)
+
+				if tag == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					if count[ft]++; count[ft] == 1 {
+						next = append(next, embedded{typ: ft, index: index})
+					}
+					continue
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				f := jsonStructField{name: tag, tagged: tag != "", index: index, typ: sf.Type}
+				if f.name == "" {
+					f.name = sf.Name
+				}
+				fields = append(fields, f)
+				// a struct embedded twice at the same depth conflicts with itself
+				if currentCount[e.typ] > 1 {
+					fields = append(fields, f)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(fields, func(a, b int) bool {
+		x, y := fields[a], fields[b]
+		if x.name != y.name {
+			return x.name < y.name
+		}
+		if len(x.index) != len(y.index) {
+			return len(x.index) < len(y.index)
+		}
+		return x.tagged && !y.tagged
+	})
+	var dominant []jsonStructField
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j-i == 1 || len(fields[i].index) != len(fields[i+1].index) || fields[i].tagged != fields[i+1].tagged {
+			dominant = append(dominant, fields[i])
+		}
+		i = j
+	}
+	// in field order, the first field wins a case insensitive match
+	sort.Slice(dominant, func(a, b int) bool { return slices.Compare(dominant[a].index, dominant[b].index) < 0 })
+	return dominant
+}
+
+// jsonField finds the field of struct type t encoding/json uses for the member name, an exact
+// match before a case insensitive one
+func jsonField(t reflect.Type, name string) (jsonStructField, bool) {
+	fields := jsonStructFields(t)
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return jsonStructField{}, false
+}
+
+// checkJSONPath reports whether the JSON Pointer tokens path can exist in values of type t
+func checkJSONPath(t reflect.Type, path []string) error {
+	for _, token := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := jsonField(t, token)
+			if !ok {
+				return errors.New("is not a field of the target")
+			}
+			t = field.typ
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Slice, reflect.Array:
+			if token != "-" {
+				if _, err := arrayIndex(token, int(^uint(0)>>1)); err != nil {
+					return err
+				}
+			}
+			t = t.Elem()
+		case reflect.Interface:
+			return nil
+		default:
+			return errors.New("is not a field of the target")
+		}
+	}
+	return nil
+}
+
+// checkMergeFields reports members of a merge patch that are not fields of type t
+func checkMergeFields(t reflect.Type, patch any, pointer string) error {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for key, value := range p {
+		var elem reflect.Type
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := jsonField(t, key)
+			if !ok {
+				return fmt.Errorf("merge patch contains unknown field %q", pointer+"/"+escapePointerToken(key))
+			}
+			elem = field.typ
+		case reflect.Map:
+			elem = t.Elem()
+		default:
+			continue
+		}
+		if err := checkMergeFields(elem, value, pointer+"/"+escapePointerToken(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONFields are the members present in a JSON body by their JSON Pointer, such as
+// "/address/city", with their raw values. Members of nested objects are included, array
+// elements are not.
+type JSONFields map[string]json.RawMessage
+
+// Has reports whether the member at pointer was sent, even as null
+func (f JSONFields) Has(pointer string) bool {
+	_, ok := f[pointer]
+	return ok
+}
+
+// IsNull reports whether the member at pointer was sent as null
+func (f JSONFields) IsNull(pointer string) bool {
+	v, ok := f[pointer]
+	return ok && string(v) == "null"
+}
+
+// ReadJSONFields reads the body into data like ReadJSON and also returns the members that
+// were present, so a PATCH handler can tell a field that was left out from one set to its
+// zero value or to null
+func (t *Tools) ReadJSONFields(w http.ResponseWriter, r *http.Request, data any) (JSONFields, error) {
+	body, err := t.readJSONBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := t.ReadJSON(w, r, data); err != nil {
+		return nil, err
+	}
+
+	fields := JSONFields{}
+	collectJSONFields(body, "", fields)
+	return fields, nil
+}
+
+func collectJSONFields(raw json.RawMessage, pointer string, fields JSONFields) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return
+	}
+	for key, value := range members {
+		p := pointer + "/" + escapePointerToken(key)
+		fields[p] = value
+		collectJSONFields(value, p, fields)
+	}
+}
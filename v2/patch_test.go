@@ -0,0 +1,260 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var jsonPatchTests = []struct {
+	name          string
+	doc           string
+	patch         string
+	expected      string
+	errorExpected string
+}{
+	{name: "add member", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`, expected: `{"baz":"qux","foo":"bar"}`},
+	{name: "add element", doc: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`, expected: `{"foo":["bar","qux","baz"]}`},
+	{name: "append", doc: `{"foo":[1]}`, patch: `[{"op":"add","path":"/foo/-","value":[2]}]`, expected: `{"foo":[1,[2]]}`},
+	{name: "remove", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, expected: `{"foo":"bar"}`},
+	{name: "remove element", doc: `{"foo":["bar","qux","baz"]}`, patch: `[{"op":"remove","path":"/foo/1"}]`, expected: `{"foo":["bar","baz"]}`},
+	{name: "replace", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"boo"}]`, expected: `{"baz":"boo","foo":"bar"}`},
+	{name: "move", doc: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+	{name: "move element", doc: `{"foo":["all","grass","cows","eat"]}`, patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, expected: `{"foo":["all","cows","eat","grass"]}`},
+	{name: "copy", doc: `{"a":{"b":1}}`, patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, expected: `{"a":{"b":1},"c":{"b":2}}`},
+	{name: "test", doc: `{"baz":"qux","foo":["a",2,"c"]}`, patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, expected: `{"baz":"qux","foo":["a",2,"c"]}`},
+	{name: "escaped keys", doc: `{"a/b":1,"m~n":2}`, patch: `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`, expected: `{"a/b":3}`},
+	{name: "null value", doc: `{"a":1}`, patch: `[{"op":"add","path":"/a","value":null}]`, expected: `{"a":null}`},
+	{name: "replace document", doc: `{"a":1}`, patch: `[{"op":"replace","path":"","value":[1]}]`, expected: `[1]`},
+	{name: "failed test", doc: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`, errorExpected: `patch operation 0 (test "/baz"): test failed, the value is different`},
+	{name: "missing member", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":1},{"op":"remove","path":"/qux"}]`, errorExpected: `patch operation 1 (remove "/qux"): path does not exist`},
+	{name: "add to missing parent", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, errorExpected: `patch operation 0 (add "/baz/bat"): path does not exist`},
+	{name: "index out of range", doc: `{"foo":[1]}`, patch: `[{"op":"add","path":"/foo/5","value":2}]`, errorExpected: `patch operation 0 (add "/foo/5"): array index 5 is out of range`},
+	{name: "bad index", doc: `{"foo":[1]}`, patch: `[{"op":"replace","path":"/foo/01","value":2}]`, errorExpected: `patch operation 0 (replace "/foo/01"): "01" is not an array index`},
+	{name: "move into child", doc: `{"a":{"b":{}}}`, patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`, errorExpected: `patch operation 0 (move "/a/b/c"): cannot move a value into one of its children`},
+	{name: "unknown op", doc: `{}`, patch: `[{"op":"merge","path":"/a"}]`, errorExpected: `patch operation 0 (merge "/a"): unknown operation`},
+	{name: "missing value", doc: `{}`, patch: `[{"op":"add","path":"/a"}]`, errorExpected: `patch operation 0 (add "/a"): value is missing`},
+	{name: "bad path", doc: `{}`, patch: `[{"op":"remove","path":"a"}]`, errorExpected: `patch operation 0 (remove "a"): path must be empty or start with /`},
+	{name: "not a patch", doc: `{}`, patch: `{"op":"add"}`, errorExpected: "request body must be a JSON Patch array of operations"},
+}
+
+func TestJSONPatch_Apply(t *testing.T) {
+	for _, e := range jsonPatchTests {
+		patch, err := ParseJSONPatch([]byte(e.patch))
+		var got []byte
+		if err == nil {
+			got, err = patch.Apply([]byte(e.doc))
+		}
+		if e.errorExpected != "" {
+			if err == nil || err.Error() != e.errorExpected {
+				t.Errorf("%s: expected error %q, got %v", e.name, e.errorExpected, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if string(got) != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+var mergePatchTests = []struct {
+	doc      string
+	patch    string
+	expected string
+}{
+	{doc: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+	{doc: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+	{doc: `{"a":"b"}`, patch: `{"a":null}`, expected: `{}`},
+	{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+	{doc: `{"a":["b"]}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+	{doc: `{"a":"c"}`, patch: `{"a":["b"]}`, expected: `{"a":["b"]}`},
+	{doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, expected: `{"a":{"b":"d"}}`},
+	{doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, expected: `{"a":[1]}`},
+	{doc: `["a","b"]`, patch: `["c","d"]`, expected: `["c","d"]`},
+	{doc: `{"a":"b"}`, patch: `["c"]`, expected: `["c"]`},
+	{doc: `{"a":"foo"}`, patch: `null`, expected: `null`},
+	{doc: `{"e":null}`, patch: `{"a":1}`, expected: `{"a":1,"e":null}`},
+	{doc: `[1,2]`, patch: `{"a":"b","c":null}`, expected: `{"a":"b"}`},
+	{doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, expected: `{"a":{"bb":{}}}`},
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, e := range mergePatchTests {
+		got, err := MergePatch([]byte(e.doc), []byte(e.patch))
+		if err != nil {
+			t.Errorf("%s + %s: %v", e.doc, e.patch, err)
+			continue
+		}
+		if string(got) != e.expected {
+			t.Errorf("%s + %s: expected %s, got %s", e.doc, e.patch, e.expected, got)
+		}
+	}
+}
+
+type address struct {
+	Street string `json:"street"`
+	City   string `json:"city,omitempty"`
+}
+
+type profile struct {
+	ID      int               `json:"-"`
+	Name    string            `json:"name"`
+	Tags    []string          `json:"tags"`
+	Address *address          `json:"address,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+func newProfile() profile {
+	return profile{ID: 7, Name: "Jane", Tags: []string{"a"}, Address: &address{Street: "Main", City: "Oslo"}}
+}
+
+var readPatchTests = []struct {
+	name          string
+	contentType   string
+	body          string
+	expected      profile
+	errorExpected string
+}{
+	{
+		name:        "json patch",
+		contentType: "application/json-patch+json",
+		body:        `[{"op":"add","path":"/tags/-","value":"b"},{"op":"remove","path":"/address/city"},{"op":"add","path":"/meta","value":{"k":"v"}}]`,
+		expected:    profile{ID: 7, Name: "Jane", Tags: []string{"a", "b"}, Address: &address{Street: "Main"}, Meta: map[string]string{"k": "v"}},
+	},
+	{
+		name:        "merge patch",
+		contentType: "application/merge-patch+json",
+		body:        `{"name":"Janet","address":{"city":null}}`,
+		expected:    profile{ID: 7, Name: "Janet", Tags: []string{"a"}, Address: &address{Street: "Main"}},
+	},
+	{
+		name:        "merge patch removes a member",
+		contentType: "application/json; charset=utf-8",
+		body:        `{"address":null}`,
+		expected:    profile{ID: 7, Name: "Jane", Tags: []string{"a"}},
+	},
+	{name: "unknown path", contentType: "application/json-patch+json", body: `[{"op":"add","path":"/admin","value":true}]`, errorExpected: `patch operation 0 (add "/admin"): "/admin" is not a field of the target`},
+	{name: "unknown from", contentType: "application/json-patch+json", body: `[{"op":"copy","from":"/id","path":"/name"}]`, errorExpected: `patch operation 0 (copy "/name"): "/id" is not a field of the target`},
+	{name: "unknown nested member", contentType: "application/merge-patch+json", body: `{"address":{"zip":"1"}}`, errorExpected: `merge patch contains unknown field "/address/zip"`},
+	{name: "wrong type", contentType: "application/merge-patch+json", body: `{"name":5}`, errorExpected: `patch sets an invalid value for the "name" field`},
+	{name: "failed test", contentType: "application/json-patch+json", body: `[{"op":"test","path":"/name","value":"Joe"}]`, errorExpected: `patch operation 0 (test "/name"): test failed, the value is different`},
+	{name: "not a patch", contentType: "text/plain", body: `name=x`, errorExpected: "request body must be a JSON Patch or a JSON Merge Patch"},
+	{name: "too large", contentType: "application/merge-patch+json", body: `{"name":"` + strings.Repeat("x", 2000) + `"}`, errorExpected: "request body must not be larger than 1024 bytes"},
+	{name: "empty", contentType: "application/merge-patch+json", errorExpected: "request body must not be empty"},
+}
+
+func TestTools_ReadPatch(t *testing.T) {
+	var testTools Tools
+	testTools.MaxJSONSize = 1024
+	for _, e := range readPatchTests {
+		req := httptest.NewRequest("PATCH", "/profiles/7", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", e.contentType)
+
+		p := newProfile()
+		err := testTools.ReadPatch(httptest.NewRecorder(), req, &p)
+		if e.errorExpected != "" {
+			if err == nil || err.Error() != e.errorExpected {
+				t.Errorf("%s: expected error %q, got %v", e.name, e.errorExpected, err)
+			}
+			if !reflect.DeepEqual(p, newProfile()) {
+				t.Errorf("%s: target changed by a failed patch: %+v", e.name, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, e.expected) {
+			t.Errorf("%s: got %+v", e.name, p)
+		}
+	}
+}
+
+func TestTools_ApplyJSONPatchUnknownFields(t *testing.T) {
+	testTools := Tools{AllowUnknownFields: true}
+	patch, _ := ParseJSONPatch([]byte(`[{"op":"add","path":"/admin","value":true},{"op":"replace","path":"/name","value":"Jo"}]`))
+	p := newProfile()
+	if err := testTools.ApplyJSONPatch(patch, &p); err != nil || p.Name != "Jo" {
+		t.Errorf("patch not applied: %+v %v", p, err)
+	}
+
+	var patchErr *PatchError
+	patch, _ = ParseJSONPatch([]byte(`[{"op":"remove","path":"/tags/3"}]`))
+	if err := testTools.ApplyJSONPatch(patch, &p); !errors.As(err, &patchErr) || patchErr.Index != 0 {
+		t.Errorf("expected a PatchError, got %v", err)
+	}
+}
+
+type auditInfo struct {
+	Meta struct {
+		By string `json:"by"`
+	} `json:"meta"`
+	Note string `json:"note"`
+	Ref  int
+}
+
+type legacyInfo struct {
+	Ref int
+}
+
+// auditedProfile shadows the meta field of the embedded auditInfo, the Ref fields of the
+// embedded structs conflict
+type auditedProfile struct {
+	auditInfo
+	legacyInfo
+	Meta map[string]string `json:"meta"`
+}
+
+func TestTools_ApplyMergePatchEmbedded(t *testing.T) {
+	var testTools Tools
+	var p auditedProfile
+	if err := testTools.ApplyMergePatch([]byte(`{"meta":{"k":"v"},"note":"n"}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Meta["k"] != "v" || p.Note != "n" || p.auditInfo.Meta.By != "" {
+		t.Errorf("patch not applied as json.Unmarshal would: %+v", p)
+	}
+
+	if err := testTools.ApplyMergePatch([]byte(`{"Ref":1}`), &p); err == nil || err.Error() != `merge patch contains unknown field "/Ref"` {
+		t.Errorf("expected the conflicting field to be unknown, got %v", err)
+	}
+}
+
+func TestTools_ReadJSONFields(t *testing.T) {
+	var testTools Tools
+	var p profile
+	req := httptest.NewRequest("PATCH", "/profiles/7", strings.NewReader(`{"name":"","address":{"city":null},"tags":null}`))
+	fields, err := testTools.ReadJSONFields(httptest.NewRecorder(), req, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for pointer, present := range map[string]bool{"/name": true, "/address": true, "/address/city": true, "/tags": true, "/meta": false, "/address/street": false} {
+		if fields.Has(pointer) != present {
+			t.Errorf("%s: expected present %v", pointer, present)
+		}
+	}
+	if !fields.IsNull("/tags") || !fields.IsNull("/address/city") || fields.IsNull("/name") {
+		t.Errorf("null members not as expected: %v", fields)
+	}
+	if p.Address == nil || p.Address.City != "" {
+		t.Errorf("body not decoded: %+v", p)
+	}
+	var raw string
+	if err := json.Unmarshal(fields["/name"], &raw); err != nil || raw != "" {
+		t.Errorf("raw value not kept: %s", fields["/name"])
+	}
+
+	req = httptest.NewRequest("PATCH", "/profiles/7", strings.NewReader(`{"nickname":"J"}`))
+	if _, err := testTools.ReadJSONFields(httptest.NewRecorder(), req, &p); err == nil || err.Error() != `request body contains unknown field "nickname"` {
+		t.Errorf("expected the ReadJSON error, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"math/bits"
+	"sync"
+)
+
+// Alphabets for RandomString
+const (
+	// AlphabetHex is lower case hexadecimal
+	AlphabetHex = "0123456789abcdef"
+	// AlphabetCrockford is Crockford's base32, without I, L, O and U
+	AlphabetCrockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	// AlphabetURLSafe is the base64url alphabet, safe in paths, query strings and file names
+	AlphabetURLSafe = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	// AlphabetUnambiguous leaves out characters that are easily confused when read or typed:
+	// 0/O/o, 1/I/i/l, 2/Z/z, 5/S/s, 8/B and U/u/V/v
+	AlphabetUnambiguous = "34679abcdefghjkmnpqrtwxyACDEFGHJKLMNPQRTWXY"
+	// AlphabetNumeric is the decimal digits
+	AlphabetNumeric = "0123456789"
+	// AlphabetAlphanumeric is digits, upper and lower case letters
+	AlphabetAlphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// randomSource hands out crypto/rand bytes from a buffer, so drawing a character costs a
+// copy instead of a system call
+type randomSource struct {
+	mu  sync.Mutex
+	buf [4096]byte
+	pos int
+}
+
+var defaultRandomSource = &randomSource{pos: 4096}
+
+// read fills p with random bytes, the mutex must be held
+func (s *randomSource) read(p []byte) {
+	for len(p) > 0 {
+		if s.pos == len(s.buf) {
+			if _, err := rand.Read(s.buf[:]); err != nil {
+				// without entropy nothing generated here can be trusted
+				panic("toolkit: crypto/rand failed: " + err.Error())
+			}
+			s.pos = 0
+		}
+		n := copy(p, s.buf[s.pos:])
+		s.pos += n
+		p = p[n:]
+	}
+}
+
+// uint64n returns a uniform random number in [0, n) using rejection sampling: values are
+// masked to the smallest power of two above n and redrawn when they fall outside the range,
+// so every value is equally likely. The mutex must be held.
+func (s *randomSource) uint64n(n uint64) uint64 {
+	if n <= 1 {
+		return 0
+	}
+	max := n - 1
+	size := (bits.Len64(max) + 7) / 8
+	mask := uint64(1)<<bits.Len64(max) - 1
+
+	var b [8]byte
+	for {
+		s.read(b[:size])
+		var v uint64
+		for _, c := range b[:size] {
+			v = v<<8 | uint64(c)
+		}
+		if v &= mask; v <= max {
+			return v
+		}
+	}
+}
+
+// indices fills dst with uniform random indices into an alphabet of n characters
+func (s *randomSource) indices(dst []int, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range dst {
+		dst[i] = int(s.uint64n(uint64(n)))
+	}
+}
+
+// randomInt returns a uniform random number in [0, n)
+func randomInt(n int) int {
+	var v [1]int
+	defaultRandomSource.indices(v[:], n)
+	return v[0]
+}
+
+// randomBytes fills p with cryptographically secure random bytes
+func randomBytes(p []byte) {
+	defaultRandomSource.mu.Lock()
+	defer defaultRandomSource.mu.Unlock()
+	defaultRandomSource.read(p)
+}
+
+// randomFrom returns length characters drawn uniformly from alphabet
+func randomFrom(alphabet []rune, length int) string {
+	if length <= 0 {
+		return ""
+	}
+	idx := make([]int, length)
+	defaultRandomSource.indices(idx, len(alphabet))
+
+	s := make([]rune, length)
+	for i, x := range idx {
+		s[i] = alphabet[x]
+	}
+	return string(s)
+}
@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"strings"
+	"testing"
+)
+
+var randomAlphabetTests = []struct {
+	name     string
+	alphabet string
+}{
+	{name: "default", alphabet: ""},
+	{name: "hex", alphabet: AlphabetHex},
+	{name: "crockford", alphabet: AlphabetCrockford},
+	{name: "url safe", alphabet: AlphabetURLSafe},
+	{name: "unambiguous", alphabet: AlphabetUnambiguous},
+	{name: "unicode", alphabet: "äöüß"},
+}
+
+func TestTools_RandomStringAlphabets(t *testing.T) {
+	var testTools Tools
+	for _, e := range randomAlphabetTests {
+		alphabet := e.alphabet
+		if alphabet == "" {
+			alphabet = ALPHABET
+		}
+
+		s := testTools.RandomString(200, e.alphabet)
+		if n := len([]rune(s)); n != 200 {
+			t.Errorf("%s: expected 200 characters, got %d", e.name, n)
+		}
+		for _, c := range s {
+			if !strings.ContainsRune(alphabet, c) {
+				t.Errorf("%s: %q is not part of the alphabet", e.name, c)
+			}
+		}
+	}
+
+	if s := testTools.RandomString(0); s != "" {
+		t.Errorf("expected an empty string, got %q", s)
+	}
+}
+
+// TestTools_RandomStringDistribution runs a chi-squared test over the default alphabet, the
+// old implementation only ever produced the characters at prime indices and fails this badly.
+func TestTools_RandomStringDistribution(t *testing.T) {
+	var testTools Tools
+
+	const samples = 64 * 2000
+	counts := make(map[rune]int)
+	for _, c := range testTools.RandomString(samples) {
+		counts[c]++
+	}
+
+	alphabet := []rune(ALPHABET)
+	if len(counts) != len(alphabet) {
+		t.Fatalf("only %d of %d characters were generated", len(counts), len(alphabet))
+	}
+
+	expected := float64(samples) / float64(len(alphabet))
+	var chi2 float64
+	for _, c := range alphabet {
+		d := float64(counts[c]) - expected
+		chi2 += d * d / expected
+	}
+
+	// 63 degrees of freedom, a uniform source exceeds 110 with a probability of about 0.01%
+	if chi2 > 110 {
+		t.Errorf("distribution is not uniform, chi-squared is %.1f", chi2)
+	}
+}
+
+func TestRandomSource_Uint64n(t *testing.T) {
+	src := &randomSource{pos: 4096}
+	for _, n := range []uint64{1, 2, 3, 255, 256, 257, 1 << 40, 1<<63 + 1, ^uint64(0)} {
+		for i := 0; i < 100; i++ {
+			if v := src.uint64n(n); v >= n && n > 1 {
+				t.Fatalf("uint64n(%d) returned %d", n, v)
+			}
+		}
+	}
+}
+
+func BenchmarkTools_RandomString(b *testing.B) {
+	var testTools Tools
+	for i := 0; i < b.N; i++ {
+		_ = testTools.RandomString(25)
+	}
+}
+
+func BenchmarkTools_RandomStringHex(b *testing.B) {
+	var testTools Tools
+	for i := 0; i < b.N; i++ {
+		_ = testTools.RandomString(32, AlphabetHex)
+	}
+}
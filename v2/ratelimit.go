@@ -0,0 +1,392 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm selects how a RateLimiter counts requests
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts of up to Requests, refilled evenly over the Window
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows Requests per Window, estimated from the counts of the current and
+	// the previous fixed window, which avoids twice the limit around a window boundary
+	SlidingWindow
+)
+
+// RateLimit is a limit of Requests per Window
+type RateLimit struct {
+	Requests  int
+	Window    time.Duration
+	Algorithm RateLimitAlgorithm
+}
+
+// RateLimitResult is the outcome of counting one request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit is fully available again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts requests per key. MemoryStore keeps the counts in the process, a
+// store shared by several instances, for example one running a script on Redis, implements
+// the same algorithms on its side.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// KeyFunc returns the key a request is counted under, an empty key is not limited
+type KeyFunc func(r *http.Request) (string, error)
+
+// RateLimiter is middleware limiting requests per key, answering with 429 via ErrorJSON
+// once the limit is reached. Every response carries the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers, a rejected one also Retry-After.
+type RateLimiter struct {
+	Tools *Tools
+	Limit RateLimit
+	// Store defaults to a MemoryStore of its own
+	Store RateLimitStore
+	// Key defaults to KeyByIP without trusted proxies
+	Key KeyFunc
+	// Prefix is put in front of the keys in the Store, so limiters sharing a store do not count
+	// against each other. It defaults to the limit, limiters with the same limit need a Prefix
+	// of their own to be counted apart.
+	Prefix string
+
+	now  func() time.Time
+	once sync.Once
+}
+
+// NewRateLimiter returns a RateLimiter allowing requests per window and client address
+func (t *Tools) NewRateLimiter(requests int, window time.Duration) *RateLimiter {
+	return &RateLimiter{Tools: t, Limit: RateLimit{Requests: requests, Window: window}}
+}
+
+func (l *RateLimiter) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+func (l *RateLimiter) tools() *Tools {
+	if l.Tools == nil {
+		return &Tools{}
+	}
+	return l.Tools
+}
+
+// Allow counts a request for key
+func (l *RateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	l.once.Do(func() {
+		if l.Store == nil {
+			l.Store = NewMemoryStore()
+		}
+	})
+	return l.Store.Allow(ctx, l.keyPrefix()+key, l.Limit, l.clock())
+}
+
+func (l *RateLimiter) keyPrefix() string {
+	if l.Prefix != "" {
+		return l.Prefix + ":"
+	}
+	return strconv.Itoa(l.Limit.Requests) + "/" + l.Limit.Window.String() + "/" + strconv.Itoa(int(l.Limit.Algorithm)) + ":"
+}
+
+// Middleware limits the requests passed to next. A failing key function rejects the request
+// with 400, a failing store lets it through and is logged, so an outage of a shared store
+// does not take the service down with it.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	keyFunc := l.Key
+	if keyFunc == nil {
+		keyFunc = KeyByIP(nil)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := l.tools()
+		key, err := keyFunc(r)
+		if err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res, err := l.Allow(r.Context(), key)
+		if err != nil {
+			t.logger().WarnContext(r.Context(), "rate limit store failed", slog.String("error", err.Error()))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		h.Set("RateLimit-Policy", strconv.Itoa(l.Limit.Requests)+";w="+strconv.Itoa(ceilSeconds(l.Limit.Window)))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			_ = t.ErrorJSON(w, errors.New("too many requests"), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// KeyByIP counts requests per client address, see TrustedProxies.ClientIP
+func KeyByIP(proxies TrustedProxies) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		return "ip:" + proxies.ClientIP(r), nil
+	}
+}
+
+// KeyByHeader counts requests per value of a header such as X-API-Key, requests without it
+// are not limited by this key. Values are hashed, so keys are not kept in the store.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		v := r.Header.Get(name)
+		if v == "" {
+			return "", nil
+		}
+		sum := sha256.Sum256([]byte(v))
+		return "header:" + hex.EncodeToString(sum[:16]), nil
+	}
+}
+
+// TrustedProxies are the addresses of reverse proxies whose X-Forwarded-For header is
+// believed
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses addresses and CIDR ranges such as "10.0.0.0/8"
+func ParseTrustedProxies(proxies ...string) (TrustedProxies, error) {
+	var trusted TrustedProxies
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, err
+			}
+			addr = addr.Unmap()
+			trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, err
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	return trusted, nil
+}
+
+func (p TrustedProxies) contains(addr netip.Addr) bool {
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is only used when the request
+// comes from a trusted proxy, and then read from the right, skipping trusted proxies, because
+// everything left of the last untrusted address may have been made up by the client.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if !p.contains(addr) {
+		return addr.String()
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseForwardedAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// a malformed hop ends the chain, the last address known to be real is used
+			return addr.String()
+		}
+		addr = hop
+		if !p.contains(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+func parseForwardedAddr(s string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), nil
+	}
+	addrPort, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addrPort.Addr().Unmap(), nil
+}
+
+// MemoryStore is an in-memory RateLimitStore, split into shards with a lock each so
+// concurrent requests for different keys rarely wait for each other. Idle keys are dropped
+// as the shards are used.
+type MemoryStore struct {
+	shards [32]memoryShard
+}
+
+type memoryShard struct {
+	mu        sync.Mutex
+	entries   map[string]*rateEntry
+	lastSweep time.Time
+}
+
+type rateEntry struct {
+	// window is the Window of the limit counting the entry, entries of limits with other
+	// windows may share the store
+	window time.Duration
+	// token bucket
+	tokens   float64
+	refilled time.Time
+	// sliding window
+	windowStart time.Time
+	current     int
+	previous    int
+
+	last time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*rateEntry)
+	}
+	return s
+}
+
+// Allow counts a request for key at now
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	if limit.Requests <= 0 || limit.Window <= 0 {
+		return RateLimitResult{}, errors.New("rate limit needs requests and a window")
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := &s.shards[h.Sum32()%uint32(len(s.shards))]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	// an entry idle for two of its windows is back to its initial state and can go
+	if now.Sub(shard.lastSweep) > limit.Window {
+		for k, e := range shard.entries {
+			if now.Sub(e.last) > 2*e.window {
+				delete(shard.entries, k)
+			}
+		}
+		shard.lastSweep = now
+	}
+
+	e, ok := shard.entries[key]
+	if !ok {
+		e = &rateEntry{tokens: float64(limit.Requests), refilled: now}
+		shard.entries[key] = e
+	}
+	e.last = now
+	e.window = limit.Window
+
+	if limit.Algorithm == SlidingWindow {
+		return e.slidingWindow(limit, now), nil
+	}
+	return e.tokenBucket(limit, now), nil
+}
+
+func (e *rateEntry) tokenBucket(limit RateLimit, now time.Time) RateLimitResult {
+	capacity := float64(limit.Requests)
+	// more requests than nanoseconds in the window would make it zero
+	perToken := max(limit.Window/time.Duration(limit.Requests), 1)
+
+	e.tokens += float64(now.Sub(e.refilled)) / float64(perToken)
+	if e.tokens > capacity {
+		e.tokens = capacity
+	}
+	e.refilled = now
+
+	res := RateLimitResult{Limit: limit.Requests}
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - e.tokens) * float64(perToken))
+	}
+	res.Remaining = int(e.tokens)
+	res.Reset = time.Duration((capacity - e.tokens) * float64(perToken))
+	return res
+}
+
+func (e *rateEntry) slidingWindow(limit RateLimit, now time.Time) RateLimitResult {
+	start := now.Truncate(limit.Window)
+	switch {
+	case start.Equal(e.windowStart):
+	case start.Sub(e.windowStart) == limit.Window:
+		e.previous, e.current = e.current, 0
+	default:
+		e.previous, e.current = 0, 0
+	}
+	e.windowStart = start
+
+	elapsed := float64(now.Sub(start)) / float64(limit.Window)
+	count := float64(e.previous)*(1-elapsed) + float64(e.current)
+	untilNext := start.Add(limit.Window).Sub(now)
+
+	res := RateLimitResult{Limit: limit.Requests, Reset: untilNext}
+	if count < float64(limit.Requests) {
+		e.current++
+		count++
+		res.Allowed = true
+	} else {
+		// the weight of the previous window has to drop until one more request fits
+		excess := count - float64(limit.Requests) + 1
+		if e.previous > 0 && float64(e.current) <= float64(limit.Requests)-1 {
+			res.RetryAfter = time.Duration(excess / float64(e.previous) * float64(limit.Window))
+		}
+		if res.RetryAfter <= 0 || res.RetryAfter > untilNext {
+			res.RetryAfter = untilNext
+		}
+	}
+	res.Remaining = limit.Requests - int(math.Ceil(count))
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	return res
+}
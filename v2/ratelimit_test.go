@@ -0,0 +1,265 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	s := NewMemoryStore()
+	limit := RateLimit{Requests: 3, Window: 3 * time.Second}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		res, _ := s.Allow(context.Background(), "k", limit, now)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i, res)
+		}
+	}
+	res, _ := s.Allow(context.Background(), "k", limit, now)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("burst not limited: %+v", res)
+	}
+	if res, _ := s.Allow(context.Background(), "other", limit, now); !res.Allowed {
+		t.Error("keys are not independent")
+	}
+
+	// one token per second comes back
+	now = now.Add(time.Second)
+	if res, _ := s.Allow(context.Background(), "k", limit, now); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("token not refilled: %+v", res)
+	}
+	now = now.Add(time.Hour)
+	if res, _ := s.Allow(context.Background(), "k", limit, now); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("bucket not capped at its size: %+v", res)
+	}
+}
+
+func TestMemoryStore_SlidingWindow(t *testing.T) {
+	s := NewMemoryStore()
+	limit := RateLimit{Requests: 10, Window: time.Minute, Algorithm: SlidingWindow}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 10; i++ {
+		if res, _ := s.Allow(context.Background(), "k", limit, start.Add(50*time.Second)); !res.Allowed {
+			t.Fatalf("request %d rejected", i)
+		}
+	}
+	res, _ := s.Allow(context.Background(), "k", limit, start.Add(55*time.Second))
+	if res.Allowed || res.RetryAfter != 5*time.Second {
+		t.Errorf("limit not enforced: %+v", res)
+	}
+
+	// right after the boundary the previous window still counts almost fully
+	if res, _ := s.Allow(context.Background(), "k", limit, start.Add(61*time.Second)); !res.Allowed {
+		t.Errorf("request fitting the weighted count rejected: %+v", res)
+	}
+	res, _ = s.Allow(context.Background(), "k", limit, start.Add(61*time.Second))
+	if res.Allowed {
+		t.Errorf("window boundary let a burst through: %+v", res)
+	}
+	if ceilSeconds(res.RetryAfter) != 11 {
+		t.Errorf("retry after not as expected: %v", res.RetryAfter)
+	}
+	// halfway through the next window half of the previous count is left
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if res, _ := s.Allow(context.Background(), "k", limit, start.Add(90*time.Second)); res.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Errorf("expected 4 more requests halfway, got %d", allowed)
+	}
+
+	// after two idle windows everything is forgotten
+	if res, _ := s.Allow(context.Background(), "k", limit, start.Add(5*time.Minute)); !res.Allowed || res.Remaining != 9 {
+		t.Errorf("state not reset: %+v", res)
+	}
+}
+
+func TestMemoryStore_Concurrent(t *testing.T) {
+	s := NewMemoryStore()
+	limit := RateLimit{Requests: 100, Window: time.Hour}
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if res, _ := s.Allow(context.Background(), "shared", limit, now); res.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 100 {
+		t.Errorf("expected exactly 100 allowed, got %d", allowed)
+	}
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	var testTools Tools
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := testTools.NewRateLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := request("192.0.2.1:1000"); rr.Code != http.StatusNoContent || rr.Header().Get("RateLimit-Remaining") != strconv.Itoa(1-i) {
+			t.Fatalf("request %d: %d %v", i, rr.Code, rr.Header())
+		}
+	}
+	rr := request("192.0.2.1:2000")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "30" || rr.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("limit response not as expected: %d %v", rr.Code, rr.Header())
+	}
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Error("limit response not sent with ErrorJSON")
+	}
+	if rr := request("192.0.2.2:1000"); rr.Code != http.StatusNoContent {
+		t.Errorf("other client limited: %d", rr.Code)
+	}
+
+	now = now.Add(30 * time.Second)
+	if rr := request("192.0.2.1:1000"); rr.Code != http.StatusNoContent {
+		t.Errorf("not allowed again after Retry-After: %d", rr.Code)
+	}
+}
+
+func TestRateLimiter_SharedStore(t *testing.T) {
+	var testTools Tools
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	perSecond := testTools.NewRateLimiter(1, time.Second)
+	perHour := testTools.NewRateLimiter(2, time.Hour)
+	for _, l := range []*RateLimiter{perSecond, perHour} {
+		l.Store = store
+		l.now = func() time.Time { return now }
+	}
+
+	ctx := context.Background()
+	if res, _ := perSecond.Allow(ctx, "ip:192.0.2.1"); !res.Allowed {
+		t.Fatal("first request not allowed")
+	}
+	for i := 0; i < 2; i++ {
+		if res, _ := perHour.Allow(ctx, "ip:192.0.2.1"); !res.Allowed {
+			t.Fatalf("request %d counted against the other limiter", i)
+		}
+	}
+
+	// the sweep of the short window must leave the hourly counts alone
+	now = now.Add(time.Minute)
+	perSecond.Allow(ctx, "ip:192.0.2.2")
+	if res, _ := perHour.Allow(ctx, "ip:192.0.2.1"); res.Allowed {
+		t.Error("hourly count reset by the other limiter")
+	}
+}
+
+func TestMemoryStore_MoreRequestsThanNanoseconds(t *testing.T) {
+	s := NewMemoryStore()
+	res, err := s.Allow(context.Background(), "k", RateLimit{Requests: 10, Window: 5}, time.Now())
+	if err != nil || !res.Allowed || res.Remaining != 9 {
+		t.Errorf("unexpected result %+v, %v", res, err)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, RateLimit, time.Time) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("connection refused")
+}
+
+func TestRateLimiter_StoreAndKeys(t *testing.T) {
+	var testTools Tools
+	testTools.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	l := testTools.NewRateLimiter(1, time.Minute)
+	l.Store = failingStore{}
+	reached := false
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !reached {
+		t.Error("failing store blocked the request")
+	}
+
+	l = testTools.NewRateLimiter(1, time.Minute)
+	l.Key = KeyByHeader("X-API-Key")
+	handler = l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	codes := map[string][]int{}
+	for _, key := range []string{"a", "a", "b", "", ""} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes[key] = append(codes[key], rr.Code)
+	}
+	if codes["a"][1] != http.StatusTooManyRequests || codes["b"][0] != http.StatusOK || codes[""][1] != http.StatusOK {
+		t.Errorf("per key limits not as expected: %v", codes)
+	}
+}
+
+var clientIPTests = []struct {
+	name       string
+	remoteAddr string
+	forwarded  []string
+	expected   string
+}{
+	{name: "direct", remoteAddr: "203.0.113.7:5000", expected: "203.0.113.7"},
+	{name: "untrusted peer sends header", remoteAddr: "203.0.113.7:5000", forwarded: []string{"1.2.3.4"}, expected: "203.0.113.7"},
+	{name: "trusted proxy", remoteAddr: "10.0.0.2:5000", forwarded: []string{"198.51.100.9"}, expected: "198.51.100.9"},
+	{name: "spoofed left entries", remoteAddr: "10.0.0.2:5000", forwarded: []string{"1.2.3.4, 198.51.100.9"}, expected: "198.51.100.9"},
+	{name: "chain of proxies", remoteAddr: "10.0.0.2:5000", forwarded: []string{"198.51.100.9, 10.0.0.5", "10.0.0.6"}, expected: "198.51.100.9"},
+	{name: "all trusted", remoteAddr: "10.0.0.2:5000", forwarded: []string{"10.0.0.5"}, expected: "10.0.0.5"},
+	{name: "malformed hop", remoteAddr: "10.0.0.2:5000", forwarded: []string{"198.51.100.9, junk"}, expected: "10.0.0.2"},
+	{name: "with port", remoteAddr: "10.0.0.2:5000", forwarded: []string{"198.51.100.9:4711"}, expected: "198.51.100.9"},
+	{name: "ipv6", remoteAddr: "[2001:db8::1]:5000", forwarded: []string{"2001:db8:ffff::9"}, expected: "2001:db8:ffff::9"},
+	{name: "mapped ipv4", remoteAddr: "[::ffff:10.0.0.2]:5000", forwarded: []string{"198.51.100.9"}, expected: "198.51.100.9"},
+	{name: "no header", remoteAddr: "10.0.0.2:5000", expected: "10.0.0.2"},
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8", "2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range clientIPTests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		for _, v := range e.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if got := proxies.ClientIP(req); got != e.expected {
+			t.Errorf("%s: got %s, expected %s", e.name, got, e.expected)
+		}
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("expected an error for an invalid range")
+	}
+}
@@ -0,0 +1,601 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TusResumable is the version of the tus protocol spoken by ResumableUploader
+const TusResumable = "1.0.0"
+
+// StatusChecksumMismatch is the tus status code returned when a chunk does not match its Upload-Checksum
+const StatusChecksumMismatch = 460
+
+// resumableStateDir is the directory below uploadDir holding partial uploads
+const resumableStateDir = ".resumable"
+
+// ResumableUploader is an http.Handler implementing tus-style resumable uploads:
+//
+//	POST   {BasePath}       create an upload, Upload-Length is required
+//	HEAD   {BasePath}/{id}  report the current Upload-Offset
+//	PATCH  {BasePath}/{id}  append a chunk at Upload-Offset, optionally verified by Upload-Checksum
+//	DELETE {BasePath}/{id}  abandon an upload
+//
+// Partial uploads live under uploadDir/.resumable until the last chunk arrives, at which
+// point the file is moved into uploadDir exactly like UploadFiles would have stored it.
+type ResumableUploader struct {
+	// Tools supplies MaxFileSize, AllowedFileTypes and the error responses
+	Tools *Tools
+	// UploadDir is where finished files are stored
+	UploadDir string
+	// BasePath is the url path the handler is mounted on, ids are appended to it
+	BasePath string
+	// Rename gives finished files a random name, as UploadFiles does by default
+	Rename bool
+	// Expiration is how long an upload may stay idle before it is purged, defaults to 24 hours
+	Expiration time.Duration
+	// OnComplete is called with the stored file once the last chunk has been written
+	OnComplete func(r *http.Request, file *UploadedFile) error
+
+	now     func() time.Time
+	locksMu sync.Mutex
+	locks   map[string]*uploadLock
+}
+
+// uploadLock serializes the requests of an upload, refs counts the requests holding or
+// waiting for it so the entry is dropped once none is left
+type uploadLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// resumableInfo is the on-disk state of an upload, the offset is the size of the part file
+type resumableInfo struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	FileName  string            `json:"file_name"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+var errUploadNotFound = errors.New("upload not found")
+
+// ResumableUploadHandler returns a ResumableUploader storing finished files in uploadDir,
+// mounted on basePath. Files are renamed unless rename is false.
+func (t *Tools) ResumableUploadHandler(uploadDir, basePath string, rename ...bool) *ResumableUploader {
+	renameFile := true
+	if len(rename) > 0 {
+		renameFile = rename[0]
+	}
+	return &ResumableUploader{
+		Tools:     t,
+		UploadDir: uploadDir,
+		BasePath:  basePath,
+		Rename:    renameFile,
+	}
+}
+
+func (u *ResumableUploader) tools() *Tools {
+	if u.Tools == nil {
+		return &Tools{}
+	}
+	return u.Tools
+}
+
+func (u *ResumableUploader) clock() time.Time {
+	if u.now != nil {
+		return u.now()
+	}
+	return time.Now()
+}
+
+func (u *ResumableUploader) expiration() time.Duration {
+	if u.Expiration > 0 {
+		return u.Expiration
+	}
+	return 24 * time.Hour
+}
+
+func (u *ResumableUploader) stateDir() string {
+	return filepath.Join(u.UploadDir, resumableStateDir)
+}
+
+func (u *ResumableUploader) infoPath(id string) string {
+	return filepath.Join(u.stateDir(), id+".info")
+}
+
+func (u *ResumableUploader) partPath(id string) string {
+	return filepath.Join(u.stateDir(), id+".part")
+}
+
+// lock serializes the requests for id, the returned func releases it. Entries only live while
+// a request uses them, so ids that do not exist never pile up.
+func (u *ResumableUploader) lock(id string) func() {
+	u.locksMu.Lock()
+	if u.locks == nil {
+		u.locks = map[string]*uploadLock{}
+	}
+	l := u.locks[id]
+	if l == nil {
+		l = &uploadLock{}
+		u.locks[id] = l
+	}
+	l.refs++
+	u.locksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		u.locksMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(u.locks, id)
+		}
+		u.locksMu.Unlock()
+	}
+}
+
+// ServeHTTP dispatches on the request method
+func (u *ResumableUploader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", TusResumable)
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(u.BasePath, "/")), "/")
+	if strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		_ = u.tools().ErrorJSON(w, errUploadNotFound, http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Tus-Version", TusResumable)
+		w.Header().Set("Tus-Extension", "creation,checksum,expiration,termination")
+		w.Header().Set("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && id == "":
+		u.create(w, r)
+	case r.Method == http.MethodHead && id != "":
+		u.head(w, r, id)
+	case r.Method == http.MethodPatch && id != "":
+		u.patch(w, r, id)
+	case r.Method == http.MethodDelete && id != "":
+		u.terminate(w, r, id)
+	default:
+		_ = u.tools().ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
+
+func (u *ResumableUploader) create(w http.ResponseWriter, r *http.Request) {
+	t := u.tools()
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		_ = t.ErrorJSON(w, errors.New("a valid Upload-Length header is required"))
+		return
+	}
+
+	maxSize := t.MaxFileSize
+	if maxSize == 0 {
+		maxSize = 1024 * 1024 * 1024
+	}
+	if length > maxSize {
+		_ = t.ErrorJSON(w, errors.New("the uploaded file is too big"), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		_ = t.ErrorJSON(w, err)
+		return
+	}
+
+	if name := metadata["filename"]; name != "" && (filepath.Base(name) == "." || filepath.Base(name) == "..") {
+		_ = t.ErrorJSON(w, errors.New("the file name is not valid"))
+		return
+	}
+
+	if err := t.CreateDirIfNotExists(u.stateDir()); err != nil {
+		u.internalError(w, r, err)
+		return
+	}
+
+	now := u.clock()
+	info := resumableInfo{
+		ID:        t.RandomString(25),
+		Length:    length,
+		FileName:  filepath.Base(metadata["filename"]),
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(u.expiration()),
+	}
+	if info.FileName == "." || info.FileName == string(filepath.Separator) {
+		info.FileName = info.ID
+	}
+
+	f, err := os.Create(u.partPath(info.ID))
+	if err != nil {
+		u.internalError(w, r, err)
+		return
+	}
+	f.Close()
+
+	if err := u.writeInfo(&info); err != nil {
+		_ = os.Remove(u.partPath(info.ID))
+		u.internalError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(u.BasePath, "/")+"/"+info.ID)
+	w.Header().Set("Upload-Expires", info.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (u *ResumableUploader) head(w http.ResponseWriter, r *http.Request, id string) {
+	unlock := u.lock(id)
+	defer unlock()
+
+	info, offset, err := u.load(id)
+	if err != nil {
+		u.stateError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	w.Header().Set("Upload-Expires", info.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (u *ResumableUploader) patch(w http.ResponseWriter, r *http.Request, id string) {
+	t := u.tools()
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		_ = t.ErrorJSON(w, errors.New("content type must be application/offset+octet-stream"), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	unlock := u.lock(id)
+	defer unlock()
+
+	info, offset, err := u.load(id)
+	if err != nil {
+		u.stateError(w, r, err)
+		return
+	}
+
+	clientOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || clientOffset != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		_ = t.ErrorJSON(w, fmt.Errorf("upload offset does not match, expected %d", offset), http.StatusConflict)
+		return
+	}
+
+	var h hash.Hash
+	var expected []byte
+	if checksum := r.Header.Get("Upload-Checksum"); checksum != "" {
+		h, expected, err = parseUploadChecksum(checksum)
+		if err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+	}
+
+	remaining := info.Length - offset
+	if r.ContentLength > remaining {
+		_ = t.ErrorJSON(w, errChunkTooLong, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	f, err := os.OpenFile(u.partPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		u.internalError(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		u.internalError(w, r, err)
+		return
+	}
+
+	release, err := t.Throttle.acquire(r.Context())
+	if err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	// one byte more than the declared length tells a chunk that is too long
+	body := t.Throttle.Reader(r.Context(), io.LimitReader(r.Body, remaining+1))
+	var dst io.Writer = f
+	if h != nil {
+		dst = io.MultiWriter(f, h)
+	}
+	n, copyErr := io.Copy(dst, body)
+
+	if n > remaining {
+		// never accept more than the declared length, the whole chunk is discarded
+		_ = f.Truncate(offset)
+		_ = t.ErrorJSON(w, errChunkTooLong, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if h != nil && (copyErr != nil || subtle.ConstantTimeCompare(h.Sum(nil), expected) != 1) {
+		// a chunk covered by a checksum is all or nothing
+		_ = f.Truncate(offset)
+		if copyErr != nil {
+			_ = t.ErrorJSON(w, copyErr)
+			return
+		}
+		_ = t.ErrorJSON(w, errors.New("upload checksum mismatch"), StatusChecksumMismatch)
+		return
+	}
+	if err := f.Sync(); err != nil {
+		u.internalError(w, r, err)
+		return
+	}
+	offset += n
+
+	info.ExpiresAt = u.clock().Add(u.expiration())
+	if err := u.writeInfo(info); err != nil {
+		u.internalError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Expires", info.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	if copyErr != nil {
+		// keep what was received so the client can resume from the new offset
+		_ = t.ErrorJSON(w, copyErr)
+		return
+	}
+
+	if offset == info.Length {
+		f.Close()
+		uploadedFile, err := u.finish(r.Context(), info)
+		if err == nil && u.OnComplete != nil {
+			err = u.OnComplete(r, uploadedFile)
+		}
+		if err != nil {
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) {
+				_ = t.ErrorJSON(w, err, statusErr.Status)
+				return
+			}
+			u.internalError(w, r, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *ResumableUploader) terminate(w http.ResponseWriter, r *http.Request, id string) {
+	unlock := u.lock(id)
+	defer unlock()
+
+	if _, _, err := u.load(id); err != nil && !errors.Is(err, errUploadExpired) {
+		u.stateError(w, r, err)
+		return
+	}
+	u.remove(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finish checks the file type of a completed upload, runs the Scanner if there is one and
+// moves the file into UploadDir. The state directory doubles as the quarantine. Errors meant
+// for the client are StatusErrors, the others are internal.
+func (u *ResumableUploader) finish(ctx context.Context, info *resumableInfo) (*UploadedFile, error) {
+	t := u.tools()
+	part := u.partPath(info.ID)
+
+	f, err := os.Open(part)
+	if err != nil {
+		return nil, err
+	}
+	buff := make([]byte, 512)
+	n, err := f.Read(buff)
+	f.Close()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if !t.isAllowedFileType(http.DetectContentType(buff[:n])) {
+		u.remove(info.ID)
+		return nil, WithStatus(errors.New("file type is not allowed"), http.StatusUnprocessableEntity)
+	}
+
+	if t.Scanner != nil {
+		if err := t.ScanFile(ctx, part); err != nil {
+			u.remove(info.ID)
+			var infected *InfectedError
+			if errors.As(err, &infected) {
+				return nil, WithStatus(err, http.StatusUnprocessableEntity)
+			}
+			return nil, err
+		}
+	}
+
+	var uploadedFile UploadedFile
+	if u.Rename {
+		uploadedFile.NewFileName = t.newFileName(info.FileName)
+	} else {
+		uploadedFile.NewFileName, err = t.keepFileName(info.FileName)
+		if err != nil {
+			u.remove(info.ID)
+			return nil, WithStatus(err, http.StatusUnprocessableEntity)
+		}
+	}
+	uploadedFile.OriginalFileName = info.FileName
+	uploadedFile.FileSize = info.Length
+
+	dst := filepath.Join(u.UploadDir, uploadedFile.NewFileName)
+	if err := t.createParentDir(dst); err != nil {
+		return nil, err
+	}
+	if err := t.MoveFile(part, dst); err != nil {
+		return nil, err
+	}
+	u.remove(info.ID)
+	return &uploadedFile, nil
+}
+
+var (
+	errUploadExpired = errors.New("upload has expired")
+	errChunkTooLong  = errors.New("chunk is longer than the rest of the upload")
+)
+
+// load reads the state of an upload and the number of bytes received so far
+func (u *ResumableUploader) load(id string) (*resumableInfo, int64, error) {
+	data, err := os.ReadFile(u.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, errUploadNotFound
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	var info resumableInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, 0, err
+	}
+	if !u.clock().Before(info.ExpiresAt) {
+		return nil, 0, errUploadExpired
+	}
+
+	stat, err := os.Stat(u.partPath(id))
+	if err != nil {
+		return nil, 0, errUploadNotFound
+	}
+	return &info, stat.Size(), nil
+}
+
+func (u *ResumableUploader) writeInfo(info *resumableInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tmp := u.infoPath(info.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.infoPath(info.ID))
+}
+
+func (u *ResumableUploader) remove(id string) {
+	_ = os.Remove(u.partPath(id))
+	_ = os.Remove(u.infoPath(id))
+}
+
+func (u *ResumableUploader) stateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errUploadNotFound):
+		_ = u.tools().ErrorJSON(w, err, http.StatusNotFound)
+	case errors.Is(err, errUploadExpired):
+		_ = u.tools().ErrorJSON(w, err, http.StatusGone)
+	default:
+		u.internalError(w, r, err)
+	}
+}
+
+// internalError logs err and answers with a generic message, file system errors would reveal
+// paths of the server to the client
+func (u *ResumableUploader) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	t := u.tools()
+	t.logger().ErrorContext(r.Context(), "resumable upload failed",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("request_id", RequestIDFromContext(r.Context())),
+		slog.String("error", err.Error()),
+	)
+	_ = t.ErrorJSON(w, errors.New("internal server error"), http.StatusInternalServerError)
+}
+
+// PurgeExpired removes every upload whose expiry has passed and returns how many were removed
+func (u *ResumableUploader) PurgeExpired() (int, error) {
+	entries, err := os.ReadDir(u.stateDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	now := u.clock()
+	purged := 0
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".info")
+		if !ok {
+			continue
+		}
+		unlock := u.lock(id)
+		data, err := os.ReadFile(u.infoPath(id))
+		var info resumableInfo
+		if err == nil && json.Unmarshal(data, &info) == nil && now.Before(info.ExpiresAt) {
+			unlock()
+			continue
+		}
+		u.remove(id)
+		unlock()
+		purged++
+	}
+	return purged, nil
+}
+
+// parseUploadMetadata decodes the tus Upload-Metadata header, "key base64value,key2 base64value"
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %q", key)
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata, nil
+}
+
+// parseUploadChecksum decodes the tus Upload-Checksum header, "algorithm base64digest"
+func parseUploadChecksum(header string) (hash.Hash, []byte, error) {
+	algorithm, value, _ := strings.Cut(strings.TrimSpace(header), " ")
+	expected, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, nil, errors.New("invalid Upload-Checksum header")
+	}
+
+	var h hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	return h, expected, nil
+}
@@ -0,0 +1,301 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func resumableRequest(method, target string, body []byte, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func createResumable(t *testing.T, u *ResumableUploader, length int, fileName string) string {
+	rr := httptest.NewRecorder()
+	u.ServeHTTP(rr, resumableRequest("POST", "/files", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(fileName)),
+	}))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	return rr.Header().Get("Location")
+}
+
+func TestTools_ResumableUpload(t *testing.T) {
+	dir := t.TempDir()
+	var testTools Tools
+	testTools.AllowedFileTypes = []string{"image/png"}
+
+	content, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var completed *UploadedFile
+	u := testTools.ResumableUploadHandler(dir, "/files", false)
+	u.OnComplete = func(r *http.Request, file *UploadedFile) error {
+		completed = file
+		return nil
+	}
+
+	location := createResumable(t, u, len(content), "img.png")
+
+	half := len(content) / 2
+	chunks := [][]byte{content[:half], content[half:]}
+	offset := 0
+	for i, chunk := range chunks {
+		// HEAD tells us where to resume
+		rr := httptest.NewRecorder()
+		u.ServeHTTP(rr, resumableRequest("HEAD", location, nil, nil))
+		if rr.Header().Get("Upload-Offset") != strconv.Itoa(offset) {
+			t.Fatalf("chunk %d: offset not as expected: %s", i, rr.Header().Get("Upload-Offset"))
+		}
+
+		sum := sha256.Sum256(chunk)
+		rr = httptest.NewRecorder()
+		u.ServeHTTP(rr, resumableRequest("PATCH", location, chunk, map[string]string{
+			"Content-Type":    "application/offset+octet-stream",
+			"Upload-Offset":   strconv.Itoa(offset),
+			"Upload-Checksum": "sha256 " + base64.StdEncoding.EncodeToString(sum[:]),
+		}))
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("chunk %d: expected 204, got %d: %s", i, rr.Code, rr.Body.String())
+		}
+		offset += len(chunk)
+	}
+
+	if completed == nil {
+		t.Fatal("OnComplete was not called")
+	}
+	if completed.NewFileName != "img.png" || completed.FileSize != int64(len(content)) {
+		t.Errorf("uploaded file not as expected: %+v", completed)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, completed.NewFileName))
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Errorf("stored file does not match the upload: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	u.ServeHTTP(rr, resumableRequest("HEAD", location, nil, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("finished upload should be gone, got %d", rr.Code)
+	}
+}
+
+var resumablePatchTests = []struct {
+	name     string
+	offset   string
+	checksum string
+	status   int
+}{
+	{name: "wrong offset", offset: "3", status: http.StatusConflict},
+	{name: "missing offset", offset: "", status: http.StatusConflict},
+	{name: "checksum mismatch", offset: "0", checksum: "sha256 " + base64.StdEncoding.EncodeToString(make([]byte, 32)), status: StatusChecksumMismatch},
+	{name: "unknown algorithm", offset: "0", checksum: "crc32 AAAA", status: http.StatusBadRequest},
+}
+
+func TestTools_ResumableUploadRejectedChunks(t *testing.T) {
+	dir := t.TempDir()
+	var testTools Tools
+	u := testTools.ResumableUploadHandler(dir, "/files")
+
+	location := createResumable(t, u, 10, "a.txt")
+	for _, e := range resumablePatchTests {
+		headers := map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": e.offset,
+		}
+		if e.checksum != "" {
+			headers["Upload-Checksum"] = e.checksum
+		}
+		rr := httptest.NewRecorder()
+		u.ServeHTTP(rr, resumableRequest("PATCH", location, []byte("hello"), headers))
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d, got %d", e.name, e.status, rr.Code)
+		}
+
+		// nothing of a rejected chunk may be kept
+		rr = httptest.NewRecorder()
+		u.ServeHTTP(rr, resumableRequest("HEAD", location, nil, nil))
+		if rr.Header().Get("Upload-Offset") != "0" {
+			t.Errorf("%s: offset moved to %s", e.name, rr.Header().Get("Upload-Offset"))
+		}
+	}
+}
+
+func TestTools_ResumableUploadTooBig(t *testing.T) {
+	var testTools Tools
+	testTools.MaxFileSize = 5
+	u := testTools.ResumableUploadHandler(t.TempDir(), "/files")
+
+	rr := httptest.NewRecorder()
+	u.ServeHTTP(rr, resumableRequest("POST", "/files", nil, map[string]string{"Upload-Length": "6"}))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rr.Code)
+	}
+}
+
+func TestTools_ResumableUploadExpiry(t *testing.T) {
+	var testTools Tools
+	u := testTools.ResumableUploadHandler(t.TempDir(), "/files")
+	u.Expiration = time.Hour
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	u.now = func() time.Time { return now }
+
+	location := createResumable(t, u, 10, "a.txt")
+	createResumable(t, u, 10, "b.txt")
+
+	n, err := u.PurgeExpired()
+	if err != nil || n != 0 {
+		t.Errorf("nothing should be purged yet, purged %d: %v", n, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	rr := httptest.NewRecorder()
+	u.ServeHTTP(rr, resumableRequest("HEAD", location, nil, nil))
+	if rr.Code != http.StatusGone {
+		t.Errorf("expected 410 for an expired upload, got %d", rr.Code)
+	}
+
+	n, err = u.PurgeExpired()
+	if err != nil || n != 2 {
+		t.Errorf("expected 2 purged uploads, got %d: %v", n, err)
+	}
+}
+
+func TestTools_ResumableUploadLocks(t *testing.T) {
+	var testTools Tools
+	u := testTools.ResumableUploadHandler(t.TempDir(), "/files")
+
+	for _, method := range []string{"HEAD", "PATCH", "DELETE"} {
+		rr := httptest.NewRecorder()
+		u.ServeHTTP(rr, resumableRequest(method, "/files/"+method, nil, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": "0",
+		}))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", method, rr.Code)
+		}
+	}
+	if len(u.locks) != 0 {
+		t.Errorf("expected no locks left, got %d", len(u.locks))
+	}
+
+	// a removed upload keeps its lock while a request still holds it
+	unlock := u.lock("a")
+	u.remove("a")
+	acquired := make(chan struct{})
+	go func() {
+		defer u.lock("a")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while another request holds it")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	<-acquired
+}
+
+func TestTools_ResumableUploadChunkTooLong(t *testing.T) {
+	var testTools Tools
+	u := testTools.ResumableUploadHandler(t.TempDir(), "/files")
+	location := createResumable(t, u, 4, "a.txt")
+
+	for _, chunked := range []bool{false, true} {
+		req := resumableRequest("PATCH", location, []byte("abcdef"), map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": "0",
+		})
+		if chunked {
+			// without a Content-Length the excess is only noticed while copying
+			req.ContentLength = -1
+		}
+		rr := httptest.NewRecorder()
+		u.ServeHTTP(rr, req)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("chunked %v: expected 413, got %d: %s", chunked, rr.Code, rr.Body.String())
+		}
+
+		rr = httptest.NewRecorder()
+		u.ServeHTTP(rr, resumableRequest("HEAD", location, nil, nil))
+		if rr.Header().Get("Upload-Offset") != "0" {
+			t.Errorf("chunked %v: chunk not discarded, offset %s", chunked, rr.Header().Get("Upload-Offset"))
+		}
+	}
+}
+
+func TestTools_ResumableUploadFileNames(t *testing.T) {
+	var testTools Tools
+	u := testTools.ResumableUploadHandler(t.TempDir(), "/files", false)
+
+	for _, name := range []string{"..", ".", "a/.."} {
+		rr := httptest.NewRecorder()
+		u.ServeHTTP(rr, resumableRequest("POST", "/files", nil, map[string]string{
+			"Upload-Length":   "1",
+			"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(name)),
+		}))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", name, rr.Code)
+		}
+	}
+}
+
+func TestTools_ResumableUploadInternalErrors(t *testing.T) {
+	var logs bytes.Buffer
+	var testTools Tools
+	testTools.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	dir := t.TempDir()
+
+	u := testTools.ResumableUploadHandler(dir, "/files")
+	u.OnComplete = func(r *http.Request, file *UploadedFile) error {
+		if file.OriginalFileName == "taken.txt" {
+			return WithStatus(errors.New("name is taken"), http.StatusConflict)
+		}
+		return fmt.Errorf("open %s: permission denied", filepath.Join(dir, file.NewFileName))
+	}
+
+	for name, expected := range map[string]struct {
+		status  int
+		message string
+	}{
+		"a.txt":     {status: http.StatusInternalServerError, message: "internal server error"},
+		"taken.txt": {status: http.StatusConflict, message: "name is taken"},
+	} {
+		location := createResumable(t, u, 1, name)
+		rr := httptest.NewRecorder()
+		u.ServeHTTP(rr, resumableRequest("PATCH", location, []byte("x"), map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": "0",
+		}))
+
+		var payload JSONResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+		if rr.Code != expected.status || payload.Message != expected.message {
+			t.Errorf("%s: response not as expected: %d %s", name, rr.Code, rr.Body.String())
+		}
+	}
+	if !strings.Contains(logs.String(), "permission denied") {
+		t.Error("internal error not logged")
+	}
+}
@@ -0,0 +1,228 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Scanner checks the content of an uploaded file. It returns an *InfectedError when the
+// content is malicious and any other error when the scan itself could not be completed.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) error
+}
+
+// ScannerFunc adapts an ordinary function to the Scanner interface
+type ScannerFunc func(ctx context.Context, r io.Reader) error
+
+// Scan calls f(ctx, r)
+func (f ScannerFunc) Scan(ctx context.Context, r io.Reader) error {
+	return f(ctx, r)
+}
+
+// InfectedError is returned when a scanner finds malware in an uploaded file
+type InfectedError struct {
+	FileName  string
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	if e.FileName == "" {
+		return fmt.Sprintf("file is infected with %s", e.Signature)
+	}
+	return fmt.Sprintf("file %s is infected with %s", e.FileName, e.Signature)
+}
+
+// ScanFailedError is returned when a file could not be scanned, the file is treated as unsafe
+type ScanFailedError struct {
+	FileName string
+	Err      error
+}
+
+func (e *ScanFailedError) Error() string {
+	return fmt.Sprintf("scanning file %s: %v", e.FileName, e.Err)
+}
+
+func (e *ScanFailedError) Unwrap() error {
+	return e.Err
+}
+
+// quarantineDir is where uploads wait for the scanner
+func (t *Tools) quarantineDir(uploadDir string) string {
+	if t.QuarantineDir != "" {
+		return t.QuarantineDir
+	}
+	return filepath.Join(uploadDir, ".quarantine")
+}
+
+// ScanFile runs the configured Scanner over a stored file and deletes it unless the scan passes
+func (t *Tools) ScanFile(ctx context.Context, filePath string) error {
+	if t.Scanner == nil {
+		return errors.New("no scanner configured")
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	err = t.Scanner.Scan(ctx, f)
+	f.Close()
+	if err == nil {
+		return nil
+	}
+
+	_ = os.Remove(filePath)
+
+	var infected *InfectedError
+	if errors.As(err, &infected) {
+		// a copy, the scanner may return a shared error value
+		named := *infected
+		if named.FileName == "" {
+			named.FileName = filepath.Base(filePath)
+		}
+		return &named
+	}
+	return &ScanFailedError{FileName: filepath.Base(filePath), Err: err}
+}
+
+// releaseFromQuarantine scans a quarantined file and moves it into uploadDir once it passed
+func (t *Tools) releaseFromQuarantine(ctx context.Context, quarantineDir, uploadDir, fileName string) error {
+	src := filepath.Join(quarantineDir, fileName)
+	if err := t.ScanFile(ctx, src); err != nil {
+		return err
+	}
+	dst := filepath.Join(uploadDir, fileName)
+	err := t.createParentDir(dst)
+	if err == nil {
+		err = t.MoveFile(src, dst)
+	}
+	if err != nil {
+		_ = os.Remove(src)
+		return err
+	}
+	return nil
+}
+
+// ClamdScanner is a Scanner talking to clamd using the INSTREAM command
+type ClamdScanner struct {
+	// Network is "tcp" or "unix", defaults to "tcp"
+	Network string
+	// Address of clamd, e.g. "127.0.0.1:3310" or "/var/run/clamav/clamd.ctl"
+	Address string
+	// Timeout for the whole scan, defaults to one minute
+	Timeout time.Duration
+	// ChunkSize is the size of the chunks streamed to clamd, defaults to 64KB
+	ChunkSize int
+}
+
+// Scan streams r to clamd and interprets its reply
+func (c *ClamdScanner) Scan(ctx context.Context, r io.Reader) error {
+	network := c.Network
+	if network == "" {
+		network = "tcp"
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 64 * 1024
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, c.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// abort blocking reads and writes as soon as the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	w := bufio.NewWriter(conn)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := w.Write(size); err != nil {
+				return err
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	// a zero length chunk ends the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := w.Write(size); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply understands "stream: OK", "stream: <signature> FOUND" and "<message> ERROR"
+func parseClamdReply(reply string) error {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	_, result, _ := strings.Cut(reply, ": ")
+	if result == "" {
+		result = reply
+	}
+
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &InfectedError{Signature: strings.TrimSuffix(result, " FOUND")}
+	case strings.HasSuffix(result, " ERROR"):
+		return fmt.Errorf("clamd: %s", strings.TrimSuffix(result, " ERROR"))
+	default:
+		return fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+}
+
+// compile time check
+var _ Scanner = (*ClamdScanner)(nil)
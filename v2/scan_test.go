@@ -0,0 +1,184 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd speaks just enough of the clamd INSTREAM protocol for the tests
+func fakeClamd(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil || cmd != "zINSTREAM\x00" {
+					_, _ = conn.Write([]byte("UNKNOWN COMMAND ERROR\x00"))
+					return
+				}
+				var data bytes.Buffer
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, r, int64(n)); err != nil {
+						return
+					}
+				}
+				if bytes.Contains(data.Bytes(), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+					_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				_, _ = conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestClamdScanner_Scan(t *testing.T) {
+	scanner := &ClamdScanner{Address: fakeClamd(t), ChunkSize: 16}
+
+	if err := scanner.Scan(context.Background(), bytes.NewReader([]byte("harmless content"))); err != nil {
+		t.Errorf("clean content reported: %v", err)
+	}
+
+	err := scanner.Scan(context.Background(), bytes.NewReader([]byte(eicar)))
+	var infected *InfectedError
+	if !errors.As(err, &infected) || infected.Signature != "Eicar-Test-Signature" {
+		t.Errorf("expected an InfectedError, got %v", err)
+	}
+}
+
+var clamdReplyTests = []struct {
+	reply    string
+	infected bool
+	isError  bool
+}{
+	{reply: "stream: OK\x00"},
+	{reply: "stream: Win.Test.EICAR_HDB-1 FOUND\x00", infected: true, isError: true},
+	{reply: "INSTREAM size limit exceeded. ERROR\x00", isError: true},
+	{reply: "garbage", isError: true},
+}
+
+func TestParseClamdReply(t *testing.T) {
+	for _, e := range clamdReplyTests {
+		err := parseClamdReply(e.reply)
+		var infected *InfectedError
+		if errors.As(err, &infected) != e.infected || (err != nil) != e.isError {
+			t.Errorf("%q: unexpected result %v", e.reply, err)
+		}
+	}
+}
+
+func multipartRequest(t *testing.T, fileName string, content []byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(content)
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+func TestTools_UploadFilesWithScanner(t *testing.T) {
+	uploadDir := t.TempDir()
+
+	var testTools Tools
+	testTools.Scanner = &ClamdScanner{Address: fakeClamd(t)}
+
+	files, err := testTools.UploadFiles(multipartRequest(t, "clean.txt", []byte("harmless content")), uploadDir, false)
+	if err != nil {
+		t.Fatalf("Error uploading clean file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, files[0].NewFileName)); err != nil {
+		t.Errorf("clean file not released from quarantine: %v", err)
+	}
+
+	_, err = testTools.UploadFiles(multipartRequest(t, "virus.txt", []byte(eicar)), uploadDir, false)
+	var infected *InfectedError
+	if !errors.As(err, &infected) || infected.FileName != "virus.txt" {
+		t.Fatalf("expected an InfectedError, got %v", err)
+	}
+	for _, p := range []string{filepath.Join(uploadDir, "virus.txt"), filepath.Join(uploadDir, ".quarantine", "virus.txt")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("infected file was not deleted: %s", p)
+		}
+	}
+}
+
+func TestTools_UploadFilesScannerUnavailable(t *testing.T) {
+	uploadDir := t.TempDir()
+
+	var testTools Tools
+	testTools.QuarantineDir = filepath.Join(uploadDir, "q")
+	testTools.Scanner = ScannerFunc(func(ctx context.Context, r io.Reader) error {
+		return errors.New("connection refused")
+	})
+
+	_, err := testTools.UploadFiles(multipartRequest(t, "clean.txt", []byte("harmless content")), uploadDir, false)
+	var failed *ScanFailedError
+	if !errors.As(err, &failed) {
+		t.Fatalf("expected a ScanFailedError, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testTools.QuarantineDir, "clean.txt")); !os.IsNotExist(err) {
+		t.Error("unscanned file was not deleted")
+	}
+}
+
+func TestTools_ScanFileSharedError(t *testing.T) {
+	shared := &InfectedError{Signature: "Eicar-Test-Signature"}
+	var testTools Tools
+	testTools.Scanner = ScannerFunc(func(ctx context.Context, r io.Reader) error {
+		return shared
+	})
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(eicar), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var infected *InfectedError
+		if err := testTools.ScanFile(context.Background(), p); !errors.As(err, &infected) || infected.FileName != name {
+			t.Errorf("expected an InfectedError for %s, got %v", name, err)
+		}
+	}
+	if shared.FileName != "" {
+		t.Errorf("scanner error changed to %q", shared.FileName)
+	}
+}
@@ -0,0 +1,459 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema. It supports the draft 2020-12 keywords type, enum,
+// const, properties, required, additionalProperties, pattern, minLength, maxLength,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, items, minItems, maxItems and
+// uniqueItems, and $ref to "#" or a JSON Pointer within the same document such as
+// "#/$defs/address". Other keywords are ignored.
+type Schema struct {
+	root *schemaNode
+}
+
+type schemaNode struct {
+	// allowNothing is the false schema
+	allowNothing bool
+
+	types    []string
+	enum     []any
+	hasConst bool
+	constant any
+	ref      *schemaNode
+
+	properties map[string]*schemaNode
+	required   []string
+	// additional checks members not in properties, nil allows them all
+	additional *schemaNode
+
+	pattern              *regexp.Regexp
+	minLength, maxLength *int
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+
+	items              *schemaNode
+	minItems, maxItems *int
+	uniqueItems        bool
+}
+
+// SchemaViolation is a place where a JSON document does not match a schema
+type SchemaViolation struct {
+	// Location is the JSON Pointer of the offending value, "" for the whole document
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+func (v SchemaViolation) String() string {
+	if v.Location == "" {
+		return "request body " + v.Message
+	}
+	return v.Location + " " + v.Message
+}
+
+// SchemaError lists every violation of a schema found in a document
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return "request body does not match the schema: " + strings.Join(msgs, "; ")
+}
+
+// CompileSchema compiles the JSON Schema data
+func CompileSchema(data []byte) (*Schema, error) {
+	root, err := decodeJSONValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	c := schemaCompiler{root: root, nodes: map[string]*schemaNode{}}
+	node, err := c.compile(root, "#")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkRefCycles(); err != nil {
+		return nil, err
+	}
+	return &Schema{root: node}, nil
+}
+
+// LoadSchema compiles the JSON Schema file name of fsys, such as an embed.FS, or of the disk
+// when fsys is nil
+func LoadSchema(fsys fs.FS, name string) (*Schema, error) {
+	var data []byte
+	var err error
+	if fsys == nil {
+		data, err = os.ReadFile(name)
+	} else {
+		data, err = fs.ReadFile(fsys, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err := CompileSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Validate checks the JSON document doc against the schema, the error is a SchemaError
+// listing all violations
+func (s *Schema) Validate(doc []byte) error {
+	v, err := decodeJSONValue(doc)
+	if err != nil {
+		return err
+	}
+	return s.validate(v)
+}
+
+func (s *Schema) validate(v any) error {
+	var violations []SchemaViolation
+	s.root.validate(v, "", &violations)
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+// schemaCompiler compiles the subschemas of one document, by their location so that
+// references, also recursive ones, share a node
+type schemaCompiler struct {
+	root  any
+	nodes map[string]*schemaNode
+}
+
+// checkRefCycles rejects references that lead back to themselves without going deeper into
+// the document, validating with them would never end
+func (c *schemaCompiler) checkRefCycles() error {
+	locations := make(map[*schemaNode]string, len(c.nodes))
+	sorted := make([]string, 0, len(c.nodes))
+	for location, node := range c.nodes {
+		locations[node] = location
+		sorted = append(sorted, location)
+	}
+	sort.Strings(sorted)
+	for _, location := range sorted {
+		seen := map[*schemaNode]bool{}
+		for n := c.nodes[location]; n != nil; n = n.ref {
+			if seen[n] {
+				return fmt.Errorf("schema: %s/$ref refers back to itself", locations[n])
+			}
+			seen[n] = true
+		}
+	}
+	return nil
+}
+
+func (c *schemaCompiler) compile(raw any, location string) (*schemaNode, error) {
+	if node, ok := c.nodes[location]; ok {
+		return node, nil
+	}
+	node := &schemaNode{}
+	c.nodes[location] = node
+
+	fail := func(keyword, msg string) error {
+		return fmt.Errorf("schema: %s/%s %s", location, keyword, msg)
+	}
+
+	switch s := raw.(type) {
+	case bool:
+		node.allowNothing = !s
+		return node, nil
+	case map[string]any:
+		for keyword, value := range s {
+			var err error
+			switch keyword {
+			case "$ref":
+				ref, ok := value.(string)
+				if !ok || !strings.HasPrefix(ref, "#") {
+					return nil, fail(keyword, "must refer to a location within the schema, like #/$defs/name")
+				}
+				path, err := parsePointer(strings.TrimPrefix(ref, "#"))
+				if err != nil {
+					return nil, fail(keyword, err.Error())
+				}
+				target, err := getValue(c.root, path)
+				if err != nil {
+					return nil, fail(keyword, fmt.Sprintf("%q does not exist", ref))
+				}
+				if node.ref, err = c.compile(target, ref); err != nil {
+					return nil, err
+				}
+			case "type":
+				switch t := value.(type) {
+				case string:
+					node.types = []string{t}
+				case []any:
+					for _, e := range t {
+						name, ok := e.(string)
+						if !ok {
+							return nil, fail(keyword, "must be a string or an array of strings")
+						}
+						node.types = append(node.types, name)
+					}
+				default:
+					return nil, fail(keyword, "must be a string or an array of strings")
+				}
+				for _, name := range node.types {
+					switch name {
+					case "null", "boolean", "object", "array", "number", "integer", "string":
+					default:
+						return nil, fail(keyword, fmt.Sprintf("%q is not a type", name))
+					}
+				}
+			case "enum":
+				values, ok := value.([]any)
+				if !ok {
+					return nil, fail(keyword, "must be an array")
+				}
+				node.enum = values
+			case "const":
+				node.hasConst, node.constant = true, value
+			case "properties":
+				members, ok := value.(map[string]any)
+				if !ok {
+					return nil, fail(keyword, "must be an object")
+				}
+				node.properties = make(map[string]*schemaNode, len(members))
+				for name, sub := range members {
+					if node.properties[name], err = c.compile(sub, location+"/properties/"+escapePointerToken(name)); err != nil {
+						return nil, err
+					}
+				}
+			case "required":
+				names, ok := value.([]any)
+				if !ok {
+					return nil, fail(keyword, "must be an array of strings")
+				}
+				for _, e := range names {
+					name, ok := e.(string)
+					if !ok {
+						return nil, fail(keyword, "must be an array of strings")
+					}
+					node.required = append(node.required, name)
+				}
+			case "additionalProperties":
+				node.additional, err = c.compile(value, location+"/"+keyword)
+			case "items":
+				node.items, err = c.compile(value, location+"/"+keyword)
+			case "pattern":
+				p, ok := value.(string)
+				if !ok {
+					return nil, fail(keyword, "must be a string")
+				}
+				if node.pattern, err = regexp.Compile(p); err != nil {
+					return nil, fail(keyword, "is not a valid regular expression")
+				}
+			case "minLength":
+				node.minLength, err = schemaInt(value, fail(keyword, "must be a non-negative integer"))
+			case "maxLength":
+				node.maxLength, err = schemaInt(value, fail(keyword, "must be a non-negative integer"))
+			case "minItems":
+				node.minItems, err = schemaInt(value, fail(keyword, "must be a non-negative integer"))
+			case "maxItems":
+				node.maxItems, err = schemaInt(value, fail(keyword, "must be a non-negative integer"))
+			case "minimum":
+				node.minimum, err = schemaNumber(value, fail(keyword, "must be a number"))
+			case "maximum":
+				node.maximum, err = schemaNumber(value, fail(keyword, "must be a number"))
+			case "exclusiveMinimum":
+				node.exclusiveMinimum, err = schemaNumber(value, fail(keyword, "must be a number"))
+			case "exclusiveMaximum":
+				node.exclusiveMaximum, err = schemaNumber(value, fail(keyword, "must be a number"))
+			case "uniqueItems":
+				node.uniqueItems, _ = value.(bool)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("schema: %s must be an object or a boolean", location)
+}
+
+// schemaInt returns the value of a keyword that takes a count, or invalid
+func schemaInt(v any, invalid error) (*int, error) {
+	f, err := schemaNumber(v, invalid)
+	if err != nil || *f < 0 || *f != math.Trunc(*f) || *f > math.MaxInt32 {
+		return nil, invalid
+	}
+	n := int(*f)
+	return &n, nil
+}
+
+// schemaNumber returns the value of a keyword that takes a number, or invalid
+func schemaNumber(v any, invalid error) (*float64, error) {
+	num, ok := v.(json.Number)
+	if !ok {
+		return nil, invalid
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return nil, invalid
+	}
+	return &f, nil
+}
+
+func (n *schemaNode) validate(v any, location string, violations *[]SchemaViolation) {
+	fail := func(format string, args ...any) {
+		*violations = append(*violations, SchemaViolation{Location: location, Message: fmt.Sprintf(format, args...)})
+	}
+	if n.allowNothing {
+		fail("is not allowed")
+		return
+	}
+	if n.ref != nil {
+		n.ref.validate(v, location, violations)
+	}
+	if len(n.types) > 0 && !slices.ContainsFunc(n.types, func(t string) bool { return jsonTypeMatches(t, v) }) {
+		fail("must be %s", joinTypes(n.types))
+		return
+	}
+	if n.enum != nil && !slices.ContainsFunc(n.enum, func(e any) bool { return jsonEqual(e, v) }) {
+		values := make([]string, len(n.enum))
+		for i, e := range n.enum {
+			b, _ := json.Marshal(e)
+			values[i] = string(b)
+		}
+		fail("must be one of %s", strings.Join(values, ", "))
+	}
+	if n.hasConst && !jsonEqual(n.constant, v) {
+		b, _ := json.Marshal(n.constant)
+		fail("must be %s", b)
+	}
+
+	switch value := v.(type) {
+	case string:
+		length := utf8.RuneCountInString(value)
+		if n.minLength != nil && length < *n.minLength {
+			fail("must be at least %d characters long", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			fail("must be at most %d characters long", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(value) {
+			fail("must match the pattern %q", n.pattern.String())
+		}
+	case json.Number:
+		f, _ := value.Float64()
+		if n.minimum != nil && f < *n.minimum {
+			fail("must be at least %v", *n.minimum)
+		}
+		if n.maximum != nil && f > *n.maximum {
+			fail("must be at most %v", *n.maximum)
+		}
+		if n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum {
+			fail("must be greater than %v", *n.exclusiveMinimum)
+		}
+		if n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum {
+			fail("must be less than %v", *n.exclusiveMaximum)
+		}
+	case []any:
+		if n.minItems != nil && len(value) < *n.minItems {
+			fail("must contain at least %d items", *n.minItems)
+		}
+		if n.maxItems != nil && len(value) > *n.maxItems {
+			fail("must contain at most %d items", *n.maxItems)
+		}
+		if n.uniqueItems && hasDuplicates(value) {
+			fail("must not contain duplicate items")
+		}
+		if n.items != nil {
+			for i, e := range value {
+				n.items.validate(e, fmt.Sprintf("%s/%d", location, i), violations)
+			}
+		}
+	case map[string]any:
+		for _, name := range n.required {
+			if _, ok := value[name]; !ok {
+				*violations = append(*violations, SchemaViolation{Location: location + "/" + escapePointerToken(name), Message: "is required"})
+			}
+		}
+		// sorted, so the violations are reported in a stable order
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			member := location + "/" + escapePointerToken(name)
+			if sub, ok := n.properties[name]; ok {
+				sub.validate(value[name], member, violations)
+			} else if n.additional != nil {
+				if n.additional.allowNothing {
+					*violations = append(*violations, SchemaViolation{Location: member, Message: "is not an allowed field"})
+					continue
+				}
+				n.additional.validate(value[name], member, violations)
+			}
+		}
+	}
+}
+
+func jsonTypeMatches(t string, v any) bool {
+	switch value := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		f, err := value.Float64()
+		return t == "integer" && err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+func joinTypes(types []string) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		switch t {
+		case "null":
+			names[i] = "null"
+		case "integer", "array", "object":
+			names[i] = "an " + t
+		default:
+			names[i] = "a " + t
+		}
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+func hasDuplicates(values []any) bool {
+	for i := range values {
+		for j := i + 1; j < len(values); j++ {
+			if jsonEqual(values[i], values[j]) {
+				return true
+			}
+		}
+	}
+	return false
+}
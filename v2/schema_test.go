@@ -0,0 +1,161 @@
+package toolkit
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//go:embed testdata/order.schema.json
+var schemaFS embed.FS
+
+var schemaTests = []struct {
+	name       string
+	doc        string
+	violations []SchemaViolation
+}{
+	{name: "valid", doc: `{"item":"tea","quantity":2,"price":1.5,"status":"paid","note":null,"tags":["a","b"],"shipping":{"city":"Oslo","country":"NO"},"parts":[{"name":"lid","parts":[{"name":"knob"}]}]}`},
+	{name: "not an object", doc: `[1]`, violations: []SchemaViolation{{Location: "", Message: "must be an object"}}},
+	{
+		name: "missing fields",
+		doc:  `{"quantity":2}`,
+		violations: []SchemaViolation{
+			{Location: "/item", Message: "is required"},
+			{Location: "/shipping", Message: "is required"},
+		},
+	},
+	{
+		name: "every field wrong",
+		doc:  `{"item":"Tea!","quantity":2.5,"price":0,"status":"lost","note":1,"tags":["a","a",3,"c"],"shipping":{"country":"SE"},"billing":"home","coupon":"x"}`,
+		violations: []SchemaViolation{
+			{Location: "/billing", Message: "must be an object"},
+			{Location: "/coupon", Message: "is not an allowed field"},
+			{Location: "/item", Message: `must match the pattern "^[a-z-]+$"`},
+			{Location: "/note", Message: "must be a string or null"},
+			{Location: "/price", Message: "must be greater than 0"},
+			{Location: "/quantity", Message: "must be an integer"},
+			{Location: "/shipping/city", Message: "is required"},
+			{Location: "/shipping/country", Message: `must be "NO"`},
+			{Location: "/status", Message: `must be one of "new", "paid"`},
+			{Location: "/tags", Message: "must contain at most 3 items"},
+			{Location: "/tags", Message: "must not contain duplicate items"},
+			{Location: "/tags/2", Message: "must be a string"},
+		},
+	},
+	{
+		name: "limits",
+		doc:  `{"item":"t","quantity":11,"shipping":{"city":""},"parts":[{"parts":[{"name":5}]}]}`,
+		violations: []SchemaViolation{
+			{Location: "/item", Message: "must be at least 2 characters long"},
+			{Location: "/parts/0/parts/0/name", Message: "must be a string"},
+			{Location: "/quantity", Message: "must be at most 10"},
+			{Location: "/shipping/city", Message: "must be at least 1 characters long"},
+		},
+	},
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := LoadSchema(schemaFS, "testdata/order.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range schemaTests {
+		err := schema.Validate([]byte(e.doc))
+		if len(e.violations) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", e.name, err)
+			}
+			continue
+		}
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Errorf("%s: expected a SchemaError, got %v", e.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(schemaErr.Violations, e.violations) {
+			t.Errorf("%s: violations not as expected:\n%v", e.name, strings.Join(strings.Split(err.Error(), "; "), "\n"))
+		}
+	}
+}
+
+var compileSchemaTests = []struct {
+	name          string
+	schema        string
+	errorExpected string
+}{
+	{name: "boolean", schema: `true`},
+	{name: "not json", schema: `{`, errorExpected: "schema: document contains badly-formed JSON"},
+	{name: "not a schema", schema: `"object"`, errorExpected: "schema: # must be an object or a boolean"},
+	{name: "bad type", schema: `{"type":"text"}`, errorExpected: `schema: #/type "text" is not a type`},
+	{name: "bad pattern", schema: `{"properties":{"a":{"pattern":"("}}}`, errorExpected: "schema: #/properties/a/pattern is not a valid regular expression"},
+	{name: "bad count", schema: `{"minLength":-1}`, errorExpected: "schema: #/minLength must be a non-negative integer"},
+	{name: "remote ref", schema: `{"$ref":"https://example.com/s.json"}`, errorExpected: "schema: #/$ref must refer to a location within the schema, like #/$defs/name"},
+	{name: "ref to itself", schema: `{"$ref":"#"}`, errorExpected: "schema: #/$ref refers back to itself"},
+	{name: "ref cycle", schema: `{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"type":"object","$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`, errorExpected: "schema: #/$defs/a/$ref refers back to itself"},
+	{name: "missing ref", schema: `{"$ref":"#/$defs/nope"}`, errorExpected: `schema: #/$ref "#/$defs/nope" does not exist`},
+}
+
+func TestCompileSchema(t *testing.T) {
+	for _, e := range compileSchemaTests {
+		_, err := CompileSchema([]byte(e.schema))
+		if e.errorExpected == "" {
+			if err != nil {
+				t.Errorf("%s: %v", e.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != e.errorExpected {
+			t.Errorf("%s: expected %q, got %v", e.name, e.errorExpected, err)
+		}
+	}
+
+	if _, err := LoadSchema(nil, "./testdata/order.schema.json"); err != nil {
+		t.Errorf("schema not loaded from disk: %v", err)
+	}
+	if s, _ := CompileSchema([]byte(`false`)); s.Validate([]byte(`{}`)) == nil {
+		t.Error("false schema accepted a document")
+	}
+}
+
+func TestTools_ReadJSONSchema(t *testing.T) {
+	var testTools Tools
+	schema, err := LoadSchema(nil, "./testdata/order.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order struct {
+		Item     string         `json:"item"`
+		Quantity int            `json:"quantity"`
+		Shipping map[string]any `json:"shipping"`
+	}
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"item":"tea","quantity":2,"shipping":{"city":"Oslo"}}`))
+	if err := testTools.ReadJSON(httptest.NewRecorder(), req, &order, schema); err != nil || order.Quantity != 2 {
+		t.Errorf("valid body not read: %+v %v", order, err)
+	}
+
+	req = httptest.NewRequest("POST", "/orders", strings.NewReader(`{"item":"tea"}`))
+	err = testTools.ReadJSON(httptest.NewRecorder(), req, &order, schema)
+	if err == nil || err.Error() != "request body does not match the schema: /quantity is required; /shipping is required" {
+		t.Errorf("expected the schema violations, got %v", err)
+	}
+
+	req = httptest.NewRequest("POST", "/orders", strings.NewReader(`{"item":`))
+	if err := testTools.ReadJSON(httptest.NewRecorder(), req, &order, schema); err == nil || err.Error() != "request body contains badly-formed JSON" {
+		t.Errorf("expected the syntax error, got %v", err)
+	}
+
+	handler := JSONHandler(&testTools, func(ctx context.Context, req map[string]any) (any, error) {
+		return req, nil
+	}, HandlerOptions{Schema: schema})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/orders", strings.NewReader(`{"item":"tea","quantity":0,"shipping":{"city":"Oslo"}}`)))
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "/quantity must be at least 1") {
+		t.Errorf("handler response not as expected: %d %s", rr.Code, rr.Body.String())
+	}
+}
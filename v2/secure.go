@@ -0,0 +1,189 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strings"
+)
+
+// ErrInvalidAPIKey is returned by ValidateAPIKey for malformed keys and keys with a bad checksum
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// apiKeyRandomLength and apiKeyChecksumLength give 178 bits of entropy and a crc32 checksum
+const (
+	apiKeyRandomLength   = 30
+	apiKeyChecksumLength = 6
+)
+
+// SecureToken returns a random token carrying at least bits bits of entropy, written in
+// AlphabetURLSafe or the alphabet passed in. 128 bits is a good choice for session and
+// password reset tokens.
+func (t *Tools) SecureToken(bits int, alphabet ...string) string {
+	a := AlphabetURLSafe
+	if len(alphabet) > 0 && alphabet[0] != "" {
+		a = alphabet[0]
+	}
+	r := []rune(a)
+	if bits <= 0 || len(r) < 2 {
+		return ""
+	}
+	length := int(math.Ceil(float64(bits) / math.Log2(float64(len(r)))))
+	return randomFrom(r, length)
+}
+
+// NumericCode returns a one-time code of the given number of digits, leading zeros included
+func (t *Tools) NumericCode(digits int) string {
+	return t.RandomString(digits, AlphabetNumeric)
+}
+
+// PasswordOptions describes the passwords generated by Password
+type PasswordOptions struct {
+	// Length of the password, defaults to 16
+	Length int
+	// Lower, Upper, Digits and Symbols require at least one character of each class
+	Lower   bool
+	Upper   bool
+	Digits  bool
+	Symbols bool
+	// ExcludeAmbiguous leaves out characters such as 0/O and 1/l/I
+	ExcludeAmbiguous bool
+}
+
+// DefaultPasswordOptions are used when Password is called without options
+var DefaultPasswordOptions = PasswordOptions{Length: 16, Lower: true, Upper: true, Digits: true, Symbols: true, ExcludeAmbiguous: true}
+
+const (
+	passwordLower   = "abcdefghijklmnopqrstuvwxyz"
+	passwordUpper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	passwordDigits  = "0123456789"
+	passwordSymbols = "!#$%&*+-=?@^_~"
+	ambiguousChars  = "0Oo1lIi|"
+)
+
+// Password returns a password containing at least one character of every required class,
+// the remaining characters are drawn from all of them and the result is shuffled
+func (t *Tools) Password(options ...PasswordOptions) (string, error) {
+	opts := DefaultPasswordOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.Length == 0 {
+		opts.Length = 16
+	}
+
+	var classes []string
+	for _, c := range []struct {
+		required bool
+		chars    string
+	}{
+		{opts.Lower, passwordLower},
+		{opts.Upper, passwordUpper},
+		{opts.Digits, passwordDigits},
+		{opts.Symbols, passwordSymbols},
+	} {
+		if !c.required {
+			continue
+		}
+		chars := c.chars
+		if opts.ExcludeAmbiguous {
+			chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(ambiguousChars, r) {
+					return -1
+				}
+				return r
+			}, chars)
+		}
+		classes = append(classes, chars)
+	}
+
+	if len(classes) == 0 {
+		return "", errors.New("at least one character class is required")
+	}
+	if opts.Length < len(classes) {
+		return "", fmt.Errorf("password length must be at least %d", len(classes))
+	}
+
+	password := make([]rune, 0, opts.Length)
+	for _, chars := range classes {
+		password = append(password, []rune(randomFrom([]rune(chars), 1))...)
+	}
+	all := []rune(strings.Join(classes, ""))
+	password = append(password, []rune(randomFrom(all, opts.Length-len(password)))...)
+
+	// Fisher-Yates, so the required characters are not always in front
+	for i := len(password) - 1; i > 0; i-- {
+		j := randomInt(i + 1)
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
+
+// NewAPIKey returns a key like "prefix_" followed by 30 random alphanumeric characters and a
+// 6 character checksum, so typos can be detected without a database lookup
+func (t *Tools) NewAPIKey(prefix string) string {
+	body := prefix + "_" + t.RandomString(apiKeyRandomLength, AlphabetAlphanumeric)
+	return body + apiKeyChecksum(body)
+}
+
+// ValidateAPIKey checks the format and checksum of a key created by NewAPIKey with prefix
+func ValidateAPIKey(key, prefix string) error {
+	if !strings.HasPrefix(key, prefix+"_") {
+		return fmt.Errorf("%w: missing prefix %q", ErrInvalidAPIKey, prefix)
+	}
+	if len(key) != len(prefix)+1+apiKeyRandomLength+apiKeyChecksumLength {
+		return fmt.Errorf("%w: wrong length", ErrInvalidAPIKey)
+	}
+
+	body, checksum := key[:len(key)-apiKeyChecksumLength], key[len(key)-apiKeyChecksumLength:]
+	for _, c := range key[len(prefix)+1:] {
+		if !strings.ContainsRune(AlphabetAlphanumeric, c) {
+			return fmt.Errorf("%w: invalid character %q", ErrInvalidAPIKey, c)
+		}
+	}
+	if !ConstantTimeEqual(checksum, apiKeyChecksum(body)) {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidAPIKey)
+	}
+	return nil
+}
+
+// apiKeyChecksum is the crc32 of the key body in fixed width base62
+func apiKeyChecksum(body string) string {
+	sum := crc32.ChecksumIEEE([]byte(body))
+	b := make([]byte, apiKeyChecksumLength)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = AlphabetAlphanumeric[sum%62]
+		sum /= 62
+	}
+	return string(b)
+}
+
+// ConstantTimeEqual compares two secrets in time independent of their content and length
+func ConstantTimeEqual(a, b string) bool {
+	// hashing first keeps the length of the secret from leaking through timing
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// HashToken returns the hex SHA-256 of a token for storage, or its HMAC-SHA256 when a key
+// (pepper) is given. It is meant for high entropy tokens such as API keys and reset tokens;
+// user chosen passwords need a slow hash such as bcrypt or argon2 instead.
+func HashToken(token string, key ...[]byte) string {
+	if len(key) > 0 && len(key[0]) > 0 {
+		mac := hmac.New(sha256.New, key[0])
+		mac.Write([]byte(token))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyTokenHash reports whether token matches a hash created by HashToken with the same key
+func VerifyTokenHash(token, hash string, key ...[]byte) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token, key...)), []byte(strings.ToLower(hash))) == 1
+}
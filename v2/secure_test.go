@@ -0,0 +1,135 @@
+package toolkit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var secureTokenTests = []struct {
+	name     string
+	bits     int
+	alphabet string
+	length   int
+}{
+	{name: "url safe 128 bits", bits: 128, length: 22},
+	{name: "hex 128 bits", bits: 128, alphabet: AlphabetHex, length: 32},
+	{name: "crockford 80 bits", bits: 80, alphabet: AlphabetCrockford, length: 16},
+	{name: "rounds up", bits: 129, alphabet: AlphabetHex, length: 33},
+	{name: "no entropy", bits: 0, length: 0},
+}
+
+func TestTools_SecureToken(t *testing.T) {
+	var testTools Tools
+	for _, e := range secureTokenTests {
+		token := testTools.SecureToken(e.bits, e.alphabet)
+		if len(token) != e.length {
+			t.Errorf("%s: expected length %d, got %d", e.name, e.length, len(token))
+		}
+	}
+}
+
+func TestTools_NumericCode(t *testing.T) {
+	var testTools Tools
+	code := testTools.NumericCode(6)
+	if len(code) != 6 || strings.Trim(code, AlphabetNumeric) != "" {
+		t.Errorf("code not as expected: %s", code)
+	}
+}
+
+var passwordTests = []struct {
+	name          string
+	options       *PasswordOptions
+	length        int
+	classes       []string
+	errorExpected bool
+}{
+	{name: "defaults", length: 16, classes: []string{passwordLower, passwordUpper, passwordDigits, passwordSymbols}},
+	{name: "digits only", options: &PasswordOptions{Length: 8, Digits: true}, length: 8, classes: []string{passwordDigits}},
+	{name: "letters", options: &PasswordOptions{Length: 4, Lower: true, Upper: true}, length: 4, classes: []string{passwordLower, passwordUpper}},
+	{name: "too short", options: &PasswordOptions{Length: 2, Lower: true, Upper: true, Digits: true}, errorExpected: true},
+	{name: "no classes", options: &PasswordOptions{Length: 8}, errorExpected: true},
+}
+
+func TestTools_Password(t *testing.T) {
+	var testTools Tools
+	for _, e := range passwordTests {
+		for i := 0; i < 50; i++ {
+			var password string
+			var err error
+			if e.options != nil {
+				password, err = testTools.Password(*e.options)
+			} else {
+				password, err = testTools.Password()
+			}
+
+			if e.errorExpected {
+				if err == nil {
+					t.Errorf("%s: expected an error", e.name)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", e.name, err)
+			}
+			if len(password) != e.length {
+				t.Fatalf("%s: expected length %d, got %q", e.name, e.length, password)
+			}
+			for _, class := range e.classes {
+				if !strings.ContainsAny(password, class) {
+					t.Fatalf("%s: %q has no character of %q", e.name, password, class)
+				}
+			}
+			if e.options == nil && strings.ContainsAny(password, ambiguousChars) {
+				t.Fatalf("%s: %q contains ambiguous characters", e.name, password)
+			}
+		}
+	}
+}
+
+func TestTools_APIKey(t *testing.T) {
+	var testTools Tools
+	key := testTools.NewAPIKey("tk_live")
+
+	if !strings.HasPrefix(key, "tk_live_") || len(key) != len("tk_live_")+36 {
+		t.Fatalf("key not as expected: %s", key)
+	}
+	if err := ValidateAPIKey(key, "tk_live"); err != nil {
+		t.Errorf("valid key rejected: %v", err)
+	}
+
+	// flip one character of the random part
+	b := []byte(key)
+	if b[10] == 'a' {
+		b[10] = 'b'
+	} else {
+		b[10] = 'a'
+	}
+	typo := string(b)
+
+	for _, k := range []string{typo, key[:len(key)-1], "tk_test" + key[7:], key + "x"} {
+		if err := ValidateAPIKey(k, "tk_live"); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("%s: expected ErrInvalidAPIKey, got %v", k, err)
+		}
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	var testTools Tools
+	token := testTools.SecureToken(128)
+
+	hash := HashToken(token)
+	if !VerifyTokenHash(token, hash) || VerifyTokenHash(token+"x", hash) {
+		t.Error("unkeyed hash verification not as expected")
+	}
+
+	key := []byte("pepper")
+	keyed := HashToken(token, key)
+	if keyed == hash || !VerifyTokenHash(token, keyed, key) || VerifyTokenHash(token, keyed) {
+		t.Error("keyed hash verification not as expected")
+	}
+
+	if !ConstantTimeEqual("abc", "abc") || ConstantTimeEqual("abc", "abd") || ConstantTimeEqual("abc", "abcd") {
+		t.Error("ConstantTimeEqual not as expected")
+	}
+}
@@ -0,0 +1,231 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrURLExpired is returned for a signed URL past its expiry
+	ErrURLExpired = errors.New("link has expired")
+	// ErrInvalidSignature is returned for a URL that was not signed, was changed after signing,
+	// was signed with an unknown key or is used by another user or address than it was bound to
+	ErrInvalidSignature = errors.New("link is not valid")
+)
+
+// SigningKey is a secret used to sign URLs, the ID goes into the URL so a key can be found
+// again after rotation
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// SignOptions configures a signed URL
+type SignOptions struct {
+	// UserID binds the URL to a user, see URLSigner.UserID
+	UserID string
+	// IP binds the URL to a client address
+	IP string
+	// DisplayName is the name the file is downloaded as, defaults to the base of the path
+	DisplayName string
+}
+
+// URLSigner mints and verifies expiring download URLs signed with HMAC-SHA256. The first key
+// signs, all keys verify, so a new key is rotated in by putting it first and an old one
+// retired by removing it once its URLs have expired.
+type URLSigner struct {
+	Tools *Tools
+	Keys  []SigningKey
+	// Skew is how long an expired URL is still accepted, to tolerate clocks that drift
+	// between the servers signing and verifying
+	Skew time.Duration
+	// UserID returns the user of a request, it is required for URLs bound to a user
+	UserID func(r *http.Request) string
+	// ClientIP returns the address of a request, defaults to the host of RemoteAddr. Behind a
+	// reverse proxy use the ClientIP method of TrustedProxies.
+	ClientIP func(r *http.Request) string
+
+	now func() time.Time
+}
+
+// query parameters of a signed URL
+const (
+	signExpires = "expires"
+	signKey     = "kid"
+	signBind    = "bind"
+	signName    = "name"
+	signature   = "sig"
+)
+
+// NewURLSigner returns a URLSigner for keys, the first of which signs
+func (t *Tools) NewURLSigner(keys ...SigningKey) *URLSigner {
+	return &URLSigner{Tools: t, Keys: keys}
+}
+
+func (s *URLSigner) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// SignURL adds an expiry ttl from now and a signature to rawURL, which may be a path or an
+// absolute URL. The path and all query parameters are signed.
+func (s *URLSigner) SignURL(rawURL string, ttl time.Duration, opts ...SignOptions) (string, error) {
+	var opt SignOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if len(s.Keys) == 0 || len(s.Keys[0].Secret) == 0 {
+		return "", errors.New("no signing key")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	for _, p := range []string{signExpires, signKey, signBind, signName, signature} {
+		q.Del(p)
+	}
+	q.Set(signExpires, strconv.FormatInt(s.clock().Add(ttl).Unix(), 10))
+	q.Set(signKey, s.Keys[0].ID)
+	if opt.DisplayName != "" {
+		q.Set(signName, opt.DisplayName)
+	}
+	bind := ""
+	if opt.UserID != "" {
+		bind += "u"
+	}
+	if opt.IP != "" {
+		bind += "i"
+	}
+	if bind != "" {
+		q.Set(signBind, bind)
+	}
+
+	q.Set(signature, sign(s.Keys[0].Secret, u.EscapedPath(), q, opt.UserID, opt.IP))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// sign is the signature of the path and query, without the signature itself, and the values
+// the URL is bound to
+func sign(secret []byte, escapedPath string, q url.Values, userID, ip string) string {
+	params := url.Values{}
+	for k, v := range q {
+		if k != signature {
+			params[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(escapedPath + "\n" + params.Encode() + "\n" + userID + "\n" + ip))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and expiry of a request for a signed URL. The path is taken
+// from the request line, so a handler below http.StripPrefix verifies the URL as signed.
+func (s *URLSigner) Verify(r *http.Request) error {
+	u := r.URL
+	if r.RequestURI != "" {
+		if parsed, err := url.ParseRequestURI(r.RequestURI); err == nil {
+			u = parsed
+		}
+	}
+	q := u.Query()
+
+	var secret []byte
+	for _, key := range s.Keys {
+		if key.ID == q.Get(signKey) {
+			secret = key.Secret
+			break
+		}
+	}
+	expires, err := strconv.ParseInt(q.Get(signExpires), 10, 64)
+	if secret == nil || err != nil {
+		return ErrInvalidSignature
+	}
+
+	var userID, ip string
+	switch q.Get(signBind) {
+	case "":
+	case "u":
+		userID = s.userID(r)
+	case "i":
+		ip = s.clientIP(r)
+	case "ui":
+		userID, ip = s.userID(r), s.clientIP(r)
+	default:
+		return ErrInvalidSignature
+	}
+
+	expected := sign(secret, u.EscapedPath(), q, userID, ip)
+	if !hmac.Equal([]byte(expected), []byte(q.Get(signature))) {
+		return ErrInvalidSignature
+	}
+	// checked after the signature, so an expiry cannot be probed on forged URLs
+	if s.clock().After(time.Unix(expires, 0).Add(s.Skew)) {
+		return ErrURLExpired
+	}
+	return nil
+}
+
+func (s *URLSigner) userID(r *http.Request) string {
+	if s.UserID == nil {
+		return ""
+	}
+	return s.UserID(r)
+}
+
+func (s *URLSigner) clientIP(r *http.Request) string {
+	if s.ClientIP != nil {
+		return s.ClientIP(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware only passes requests with a valid signed URL to next, others get an ErrorJSON
+// response with status 403
+func (s *URLSigner) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Verify(r); err != nil {
+			_ = s.tools().ErrorJSON(w, err, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DownloadHandler serves the files below root for signed URLs with DownloadStaticFile, using
+// the signed display name. The request path is the path of the file below root, mount the
+// handler with http.StripPrefix to serve it below a prefix.
+func (s *URLSigner) DownloadHandler(root string) http.Handler {
+	return s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		displayName := r.URL.Query().Get(signName)
+		if displayName == "" {
+			displayName = path.Base(name)
+		}
+		s.tools().DownloadStaticFile(w, r, filepath.Join(root, filepath.FromSlash(name)), displayName)
+	}))
+}
+
+func (s *URLSigner) tools() *Tools {
+	if s.Tools == nil {
+		return &Tools{}
+	}
+	return s.Tools
+}
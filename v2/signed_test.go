@@ -0,0 +1,137 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSigner(now *time.Time) *URLSigner {
+	var testTools Tools
+	s := testTools.NewURLSigner(SigningKey{ID: "k1", Secret: []byte("first secret")})
+	s.now = func() time.Time { return *now }
+	s.UserID = func(r *http.Request) string { return r.Header.Get("X-User") }
+	return s
+}
+
+func signedRequest(t *testing.T, signed, user, remoteAddr string) *http.Request {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", u.RequestURI(), nil)
+	req.Header.Set("X-User", user)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	return req
+}
+
+func TestURLSigner_Verify(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := testSigner(&now)
+	s.Skew = 30 * time.Second
+
+	plain, _ := s.SignURL("https://files.example.com/invoices/2024.pdf?v=2", time.Hour)
+	if !strings.HasPrefix(plain, "https://files.example.com/invoices/2024.pdf?") {
+		t.Errorf("host or path not kept: %s", plain)
+	}
+	user, _ := s.SignURL("/invoices/2024.pdf", time.Hour, SignOptions{UserID: "42"})
+	ip, _ := s.SignURL("/invoices/2024.pdf", time.Hour, SignOptions{IP: "192.0.2.1"})
+
+	var verifyTests = []struct {
+		name     string
+		req      *http.Request
+		at       time.Duration
+		expected error
+	}{
+		{name: "valid", req: signedRequest(t, plain, "", "")},
+		{name: "within skew", req: signedRequest(t, plain, "", ""), at: time.Hour + 20*time.Second},
+		{name: "expired", req: signedRequest(t, plain, "", ""), at: time.Hour + time.Minute, expected: ErrURLExpired},
+		{name: "path changed", req: signedRequest(t, strings.Replace(plain, "2024.pdf", "2023.pdf", 1), "", ""), expected: ErrInvalidSignature},
+		{name: "parameter changed", req: signedRequest(t, strings.Replace(plain, "v=2", "v=3", 1), "", ""), expected: ErrInvalidSignature},
+		{name: "expiry changed", req: signedRequest(t, strings.Replace(plain, "expires=1", "expires=2", 1), "", ""), expected: ErrInvalidSignature},
+		{name: "unsigned", req: httptest.NewRequest("GET", "/invoices/2024.pdf", nil), expected: ErrInvalidSignature},
+		{name: "bound user", req: signedRequest(t, user, "42", "")},
+		{name: "other user", req: signedRequest(t, user, "43", ""), expected: ErrInvalidSignature},
+		{name: "binding removed", req: signedRequest(t, strings.Replace(user, "bind=u", "bind=", 1), "", ""), expected: ErrInvalidSignature},
+		{name: "bound address", req: signedRequest(t, ip, "", "192.0.2.1:5000")},
+		{name: "other address", req: signedRequest(t, ip, "", "192.0.2.2:5000"), expected: ErrInvalidSignature},
+	}
+
+	start := now
+	for _, e := range verifyTests {
+		now = start.Add(e.at)
+		if err := s.Verify(e.req); !errors.Is(err, e.expected) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expected, err)
+		}
+	}
+}
+
+func TestURLSigner_KeyRotation(t *testing.T) {
+	now := time.Now()
+	s := testSigner(&now)
+	old, _ := s.SignURL("/a.txt", time.Hour)
+
+	s.Keys = append([]SigningKey{{ID: "k2", Secret: []byte("second secret")}}, s.Keys...)
+	current, _ := s.SignURL("/a.txt", time.Hour)
+	if !strings.Contains(current, "kid=k2") {
+		t.Errorf("new key not used for signing: %s", current)
+	}
+	for _, signed := range []string{old, current} {
+		if err := s.Verify(signedRequest(t, signed, "", "")); err != nil {
+			t.Errorf("%s: %v", signed, err)
+		}
+	}
+
+	s.Keys = s.Keys[:1]
+	if err := s.Verify(signedRequest(t, old, "", "")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("retired key still accepted: %v", err)
+	}
+
+	s.Keys = nil
+	if _, err := s.SignURL("/a.txt", time.Hour); err == nil {
+		t.Error("expected an error signing without a key")
+	}
+}
+
+func TestURLSigner_DownloadHandler(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "2024"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "2024", "01HX.pdf"), []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	s := testSigner(&now)
+	handler := http.StripPrefix("/files", s.DownloadHandler(root))
+
+	signed, _ := s.SignURL("/files/2024/01HX.pdf", time.Minute, SignOptions{DisplayName: "Invoice.pdf"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, signedRequest(t, signed, "", ""))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Disposition") != `attachment; filename="Invoice.pdf"` {
+		t.Fatalf("download not as expected: %d %v", rr.Code, rr.Header())
+	}
+	if body, _ := io.ReadAll(rr.Body); string(body) != "%PDF-1.4" {
+		t.Errorf("content not as expected: %q", body)
+	}
+
+	now = now.Add(2 * time.Minute)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, signedRequest(t, signed, "", ""))
+	var payload JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil || rr.Code != http.StatusForbidden || payload.Message != ErrURLExpired.Error() {
+		t.Errorf("expired link not rejected: %d %s", rr.Code, rr.Body.String())
+	}
+}
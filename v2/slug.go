@@ -0,0 +1,304 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SlugOptions configures SlugifyWith, the zero value transliterates with the default table
+type SlugOptions struct {
+	// Language selects a transliteration table for languages that romanise the same letter
+	// differently, e.g. "de" turns ü into ue where the default is u. See SlugLanguages.
+	Language string
+	// Transliterations are applied before the language and default tables, keys are lower case
+	Transliterations map[rune]string
+	// KeepUnicode keeps letters and digits that have no transliteration, e.g. Japanese or
+	// Arabic, instead of dropping them
+	KeepUnicode bool
+	// Separator joins the words of the slug, defaults to "-"
+	Separator string
+	// MaxLength caps the number of characters, the slug is cut at a word boundary when possible
+	MaxLength int
+	// RemoveStopWords drops the SlugStopWords of Language, English when no language is set,
+	// unless the slug would be empty without them
+	RemoveStopWords bool
+	// StopWords are removed in addition to the language's stop words
+	StopWords []string
+	// Replacements are applied to the input before anything else, e.g. "&" to "and". The
+	// replacement is treated as a word of its own.
+	Replacements map[string]string
+}
+
+// SlugStopWords holds the stop words removed by RemoveStopWords, keyed by ISO 639-1 code
+var SlugStopWords = map[string][]string{
+	"en": {"a", "an", "and", "are", "as", "at", "be", "by", "for", "from", "in", "is", "it", "of", "on", "or", "the", "to", "with"},
+	"de": {"der", "die", "das", "den", "dem", "des", "ein", "eine", "einer", "und", "oder", "in", "im", "mit", "von", "zu", "für", "auf", "ist"},
+	"fr": {"le", "la", "les", "l", "un", "une", "des", "du", "de", "d", "et", "ou", "à", "au", "aux", "en", "pour", "par", "sur"},
+	"es": {"el", "la", "los", "las", "un", "una", "unos", "unas", "y", "o", "de", "del", "en", "a", "al", "con", "para", "por"},
+	"tr": {"ve", "veya", "ile", "bir", "bu", "şu", "da", "de", "ki", "mi", "için"},
+}
+
+// SlugLanguages holds the language specific transliteration tables, keyed by ISO 639-1 code
+var SlugLanguages = map[string]map[rune]string{
+	"de": {'ä': "ae", 'ö': "oe", 'ü': "ue", 'ß': "ss"},
+	"tr": {'ç': "c", 'ğ': "g", 'ı': "i", 'ö': "o", 'ş': "s", 'ü': "u"},
+	"fr": {'œ': "oe", 'æ': "ae", 'ç': "c"},
+	"da": {'æ': "ae", 'ø': "oe", 'å': "aa"},
+	"no": {'æ': "ae", 'ø': "oe", 'å': "aa"},
+	"sv": {'å': "a", 'ä': "a", 'ö': "o"},
+	"fi": {'å': "a", 'ä': "a", 'ö': "o"},
+	"is": {'þ': "th", 'ð': "d", 'æ': "ae", 'ö': "o"},
+	"uk": {'г': "h", 'ґ': "g", 'и': "y", 'і': "i", 'ї': "i", 'є': "ie", 'й': "i", 'х': "kh", 'щ': "shch"},
+	"bg": {'щ': "sht", 'ъ': "a", 'ь': "y", 'ю': "yu", 'я': "ya"},
+}
+
+// slugDefaults romanises letters that are not just a base letter with a diacritic: Cyrillic
+// (Russian with the Ukrainian, Serbian and Macedonian extras), Greek and Latin letters without
+// a Unicode decomposition. Other letters with diacritics are decomposed to their base letter.
+var slugDefaults = map[rune]string{
+	// Latin
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'þ': "th", 'ð': "d", 'đ': "d", 'ł': "l",
+	'ı': "i", 'ħ': "h", 'ŀ': "l", 'ŋ': "n", 'ŧ': "t", 'ſ': "s", 'ĸ': "k", 'ƒ': "f", 'ĳ': "ij",
+
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ђ': "dj", 'ј': "j", 'љ': "lj",
+	'њ': "nj", 'ћ': "c", 'џ': "dz", 'ѓ': "gj", 'ќ': "kj", 'ѕ': "dz",
+
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o",
+}
+
+// SlugifyWith makes a slug like Slugify, configured by opts
+func (t *Tools) SlugifyWith(s string, opts SlugOptions) (string, error) {
+	if s == "" {
+		return "", errors.New("string is empty")
+	}
+
+	words := slugWords(replaceSlugWords(s, opts.Replacements), opts)
+	if opts.RemoveStopWords || len(opts.StopWords) > 0 {
+		words = removeStopWords(words, opts)
+	}
+
+	slug := joinSlugWords(words, opts)
+	if len(slug) == 0 {
+		return "", errors.New("slug is empty")
+	}
+	return slug, nil
+}
+
+// UniqueSlug makes a slug and appends -2, -3, … (using the separator) until exists reports
+// the slug is free. MaxLength is respected by shortening the slug before the suffix.
+func (t *Tools) UniqueSlug(s string, exists func(slug string) (bool, error), opts ...SlugOptions) (string, error) {
+	var o SlugOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	slug, err := t.SlugifyWith(s, o)
+	if err != nil {
+		return "", err
+	}
+
+	const maxAttempts = 10000
+	candidate := slug
+	for i := 2; i <= maxAttempts+1; i++ {
+		taken, err := exists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix := slugSeparator(o) + strconv.Itoa(i)
+		base := slug
+		if o.MaxLength > 0 {
+			if o.MaxLength <= utf8.RuneCountInString(suffix) {
+				return "", errors.New("max length is too small for a unique slug")
+			}
+			sub := o
+			sub.MaxLength -= utf8.RuneCountInString(suffix)
+			base, _ = t.SlugifyWith(s, sub)
+		}
+		candidate = base + suffix
+	}
+	return "", fmt.Errorf("no unique slug found after %d attempts", maxAttempts)
+}
+
+func slugSeparator(opts SlugOptions) string {
+	if opts.Separator == "" {
+		return "-"
+	}
+	return opts.Separator
+}
+
+// replaceSlugWords applies the replacements, longest first so overlapping keys are predictable
+func replaceSlugWords(s string, replacements map[string]string) string {
+	if len(replacements) == 0 {
+		return s
+	}
+	keys := make([]string, 0, len(replacements))
+	for k := range replacements {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k, " "+replacements[k]+" ")
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// removeStopWords drops stop words, compared after transliteration, unless nothing would remain
+func removeStopWords(words []string, opts SlugOptions) []string {
+	plain := SlugOptions{Language: opts.Language, Transliterations: opts.Transliterations, KeepUnicode: opts.KeepUnicode}
+
+	stop := make(map[string]bool)
+	var lists [][]string
+	if opts.RemoveStopWords {
+		language := strings.ToLower(opts.Language)
+		if language == "" {
+			language = "en"
+		}
+		lists = append(lists, SlugStopWords[language])
+	}
+	lists = append(lists, opts.StopWords)
+	for _, list := range lists {
+		for _, w := range list {
+			for _, sw := range slugWords(w, plain) {
+				stop[sw] = true
+			}
+		}
+	}
+
+	kept := make([]string, 0, len(words))
+	for _, w := range words {
+		if !stop[w] {
+			kept = append(kept, w)
+		}
+	}
+	if len(kept) == 0 {
+		return words
+	}
+	return kept
+}
+
+// joinSlugWords joins words with the separator, stopping at the last word that fits in
+// MaxLength. A first word longer than MaxLength is cut.
+func joinSlugWords(words []string, opts SlugOptions) string {
+	sep := slugSeparator(opts)
+	if opts.MaxLength <= 0 {
+		return strings.Join(words, sep)
+	}
+
+	var b strings.Builder
+	length := 0
+	for i, w := range words {
+		n := utf8.RuneCountInString(w)
+		if i > 0 {
+			n += utf8.RuneCountInString(sep)
+		}
+		if length+n > opts.MaxLength {
+			if i == 0 {
+				b.WriteString(string([]rune(w)[:opts.MaxLength]))
+			}
+			break
+		}
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(w)
+		length += n
+	}
+	return b.String()
+}
+
+// slugWords transliterates s and splits it into the words a slug is made of
+func slugWords(s string, opts SlugOptions) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	var prev rune
+	for _, r := range transliterate(s, opts) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			word.WriteRune(r)
+		case r > unicode.MaxASCII && opts.KeepUnicode && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word.WriteRune(r)
+		case unicode.In(r, unicode.Mn, unicode.Mc):
+			// a combining mark belongs to the letter before it, it is part of the word in
+			// scripts that are kept and a diacritic to strip on romanised letters
+			if opts.KeepUnicode && prev > unicode.MaxASCII && word.Len() > 0 {
+				word.WriteRune(r)
+			}
+			continue
+		default:
+			flush()
+		}
+		prev = r
+	}
+	flush()
+	return words
+}
+
+// transliterate lower cases s and romanises it using opts, the language and default tables
+func transliterate(s string, opts SlugOptions) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteString(transliterateRune(unicode.ToLower(r), opts))
+	}
+	return b.String()
+}
+
+// transliterateRune romanises a lower case rune, runes without a romanisation are kept
+func transliterateRune(r rune, opts SlugOptions) string {
+	if v, ok := opts.Transliterations[r]; ok {
+		return v
+	}
+	if r <= unicode.MaxASCII {
+		return string(r)
+	}
+	if v, ok := SlugLanguages[strings.ToLower(opts.Language)][r]; ok {
+		return v
+	}
+	if v, ok := slugDefaults[r]; ok {
+		return v
+	}
+	// a letter with diacritics is romanised as its base letter, Unicode normalisation splits
+	// it into the base and combining marks
+	if base, size := utf8.DecodeRuneInString(norm.NFD.String(string(r))); size > 0 && base != r {
+		// scripts that are kept as they are keep their letters whole
+		if v := transliterateRune(base, opts); !strings.ContainsFunc(v, func(c rune) bool { return c > unicode.MaxASCII }) {
+			return v
+		}
+	}
+	return string(r)
+}
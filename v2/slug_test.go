@@ -0,0 +1,106 @@
+package toolkit
+
+import (
+	"errors"
+	"testing"
+)
+
+var slugifyWithTests = []struct {
+	name     string
+	s        string
+	opts     SlugOptions
+	expected string
+}{
+	{name: "turkish", s: "Çağrı Göğüş", expected: "cagri-gogus"},
+	{name: "turkish dotted capital", s: "İstanbul IĞDIR", opts: SlugOptions{Language: "tr"}, expected: "istanbul-igdir"},
+	{name: "german default", s: "Grüße aus Köln", expected: "grusse-aus-koln"},
+	{name: "german", s: "Grüße aus Köln", opts: SlugOptions{Language: "de"}, expected: "gruesse-aus-koeln"},
+	{name: "french", s: "Œuvre complète à Noël", opts: SlugOptions{Language: "fr"}, expected: "oeuvre-complete-a-noel"},
+	{name: "danish", s: "Smørrebrød på Ærø", opts: SlugOptions{Language: "da"}, expected: "smoerrebroed-paa-aeroe"},
+	{name: "swedish", s: "Smörgåsbord", opts: SlugOptions{Language: "sv"}, expected: "smorgasbord"},
+	{name: "icelandic", s: "Þingvellir Ísland", opts: SlugOptions{Language: "is"}, expected: "thingvellir-island"},
+	{name: "russian", s: "Привет, мир!", expected: "privet-mir"},
+	{name: "ukrainian", s: "Київ Гончарівка", opts: SlugOptions{Language: "uk"}, expected: "kyiv-honcharivka"},
+	{name: "greek", s: "Καλημέρα κόσμε", expected: "kalimera-kosme"},
+	{name: "decomposed accents", s: "café déjà", expected: "cafe-deja"},
+	{name: "vietnamese", s: "Phở Việt Nam", expected: "pho-viet-nam"},
+	{name: "letters outside the common accents", s: "ḃṁǿ Ǘ ẞ ṩ", expected: "bmo-u-ss-s"},
+	{name: "greek accents", s: "Ώρα ΐ ΰ", expected: "ora-i-y"},
+	{name: "custom table", s: "a+b", opts: SlugOptions{Transliterations: map[rune]string{'+': "plus"}}, expected: "aplusb"},
+	{name: "keep unicode", s: "東京 Tower!", opts: SlugOptions{KeepUnicode: true}, expected: "東京-tower"},
+	{name: "keep unicode marks", s: "नमस्ते दुनिया", opts: SlugOptions{KeepUnicode: true}, expected: "नमस्ते-दुनिया"},
+	{name: "keep unicode still romanises", s: "Çağrı 東京", opts: SlugOptions{KeepUnicode: true}, expected: "cagri-東京"},
+}
+
+func TestTools_SlugifyWith(t *testing.T) {
+	var testTools Tools
+	for _, e := range slugifyWithTests {
+		slug, err := testTools.SlugifyWith(e.s, e.opts)
+		if err != nil {
+			t.Errorf("%s: Error slugifying string: %v", e.name, err)
+		}
+		if slug != e.expected {
+			t.Errorf("%s: Slug not as expected: %s", e.name, slug)
+		}
+	}
+
+	if _, err := testTools.SlugifyWith("これは日本語", SlugOptions{}); err == nil {
+		t.Error("expected an error for a slug without romanisable characters")
+	}
+}
+
+var slugOptionsTests = []struct {
+	name     string
+	s        string
+	opts     SlugOptions
+	expected string
+}{
+	{name: "separator", s: "Hello big world", opts: SlugOptions{Separator: "_"}, expected: "hello_big_world"},
+	{name: "max length at word boundary", s: "The quick brown fox", opts: SlugOptions{MaxLength: 12}, expected: "the-quick"},
+	{name: "max length exact", s: "The quick brown fox", opts: SlugOptions{MaxLength: 15}, expected: "the-quick-brown"},
+	{name: "max length cuts a long first word", s: "Supercalifragilistic", opts: SlugOptions{MaxLength: 5}, expected: "super"},
+	{name: "english stop words", s: "The Lord of the Rings", opts: SlugOptions{RemoveStopWords: true}, expected: "lord-rings"},
+	{name: "german stop words", s: "Die Katze für den Hund", opts: SlugOptions{Language: "de", RemoveStopWords: true}, expected: "katze-hund"},
+	{name: "only stop words are kept", s: "To be or not to be", opts: SlugOptions{StopWords: []string{"to", "be", "or", "not"}}, expected: "to-be-or-not-to-be"},
+	{name: "custom stop words", s: "Acme Inc announces", opts: SlugOptions{StopWords: []string{"inc"}}, expected: "acme-announces"},
+	{name: "replacements", s: "Rock&Roll @ home", opts: SlugOptions{Replacements: map[string]string{"&": "and", "@": "at"}}, expected: "rock-and-roll-at-home"},
+}
+
+func TestTools_SlugifyOptions(t *testing.T) {
+	var testTools Tools
+	for _, e := range slugOptionsTests {
+		slug, err := testTools.SlugifyWith(e.s, e.opts)
+		if err != nil {
+			t.Errorf("%s: Error slugifying string: %v", e.name, err)
+		}
+		if slug != e.expected {
+			t.Errorf("%s: Slug not as expected: %s", e.name, slug)
+		}
+	}
+}
+
+func TestTools_UniqueSlug(t *testing.T) {
+	var testTools Tools
+	taken := map[string]bool{"hello-world": true, "hello-world-2": true, "hello-3": true}
+	exists := func(slug string) (bool, error) { return taken[slug], nil }
+
+	slug, err := testTools.UniqueSlug("Hello World", exists)
+	if err != nil || slug != "hello-world-3" {
+		t.Errorf("unique slug not as expected: %s, %v", slug, err)
+	}
+
+	slug, err = testTools.UniqueSlug("Fresh title", exists)
+	if err != nil || slug != "fresh-title" {
+		t.Errorf("free slug not kept: %s, %v", slug, err)
+	}
+
+	// the suffix has to fit into MaxLength, shortening the slug to a word boundary
+	slug, err = testTools.UniqueSlug("Hello World", exists, SlugOptions{MaxLength: 11})
+	if err != nil || slug != "hello-2" {
+		t.Errorf("unique slug with max length not as expected: %s, %v", slug, err)
+	}
+
+	if _, err := testTools.UniqueSlug("Hello World", func(string) (bool, error) { return false, errors.New("db down") }); err == nil {
+		t.Error("expected the callback error")
+	}
+}
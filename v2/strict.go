@@ -0,0 +1,173 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Errors wrapped by a StrictJSONError, telling which of the StrictJSONOptions was violated
+var (
+	ErrDuplicateKey   = errors.New("duplicate key")
+	ErrJSONTooDeep    = errors.New("json nested too deeply")
+	ErrArrayTooLong   = errors.New("json array too long")
+	ErrStringTooLong  = errors.New("json string too long")
+	ErrNumberOverflow = errors.New("json number out of range")
+	ErrInvalidUTF8    = errors.New("invalid utf-8")
+)
+
+// StrictJSONOptions makes ReadJSON reject bodies that decoders disagree on or that are
+// expensive to decode. The zero value accepts what encoding/json accepts.
+type StrictJSONOptions struct {
+	// DisallowDuplicateKeys rejects objects with the same key twice, encoding/json keeps the last
+	// one while other decoders keep the first. Keys are compared without regard to case, as
+	// encoding/json matches them to struct fields that way.
+	DisallowDuplicateKeys bool
+	// MaxDepth caps the nesting of objects and arrays
+	MaxDepth int
+	// MaxArrayLength caps the number of items of every array
+	MaxArrayLength int
+	// MaxStringLength caps the characters of every string, object keys included
+	MaxStringLength int
+	// UseNumber decodes numbers into interface values as json.Number rather than float64, so
+	// large integers keep their precision
+	UseNumber bool
+	// RejectOverflowingNumbers rejects numbers beyond the range of float64, which other
+	// decoders turn into infinity
+	RejectOverflowingNumbers bool
+	// RejectInvalidUTF8 rejects bodies that are not valid UTF-8, encoding/json replaces the
+	// invalid bytes of strings with U+FFFD
+	RejectInvalidUTF8 bool
+}
+
+// StrictJSONError is a violation of the StrictJSONOptions, Offset is the position in the body
+// after the offending value
+type StrictJSONError struct {
+	Err     error
+	Message string
+	Offset  int64
+}
+
+func (e *StrictJSONError) Error() string {
+	return fmt.Sprintf("request body %s (at position %d)", e.Message, e.Offset)
+}
+
+func (e *StrictJSONError) Unwrap() error {
+	return e.Err
+}
+
+// enabled reports whether bodies have to be checked before decoding
+func (o StrictJSONOptions) enabled() bool {
+	return o.DisallowDuplicateKeys || o.MaxDepth > 0 || o.MaxArrayLength > 0 || o.MaxStringLength > 0 ||
+		o.RejectOverflowingNumbers || o.RejectInvalidUTF8
+}
+
+// jsonFrame is an object or array being scanned by check
+type jsonFrame struct {
+	object    bool
+	expectKey bool
+	// keys holds the case folded keys of an object
+	keys  map[string]struct{}
+	items int
+}
+
+// check scans body for violations of the options. Badly-formed JSON is not reported here,
+// the decoder describes it.
+func (o StrictJSONOptions) check(body []byte) error {
+	if o.RejectInvalidUTF8 {
+		for i := 0; i < len(body); {
+			r, size := utf8.DecodeRune(body[i:])
+			if r == utf8.RuneError && size == 1 {
+				return &StrictJSONError{Err: ErrInvalidUTF8, Message: "contains invalid UTF-8", Offset: int64(i)}
+			}
+			i += size
+		}
+	}
+	if !o.DisallowDuplicateKeys && o.MaxDepth <= 0 && o.MaxArrayLength <= 0 && o.MaxStringLength <= 0 && !o.RejectOverflowingNumbers {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var stack []*jsonFrame
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		offset := dec.InputOffset()
+		fail := func(kind error, format string, args ...any) error {
+			return &StrictJSONError{Err: kind, Message: fmt.Sprintf(format, args...), Offset: offset}
+		}
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		if s, ok := tok.(string); ok && top != nil && top.expectKey {
+			if o.MaxStringLength > 0 && utf8.RuneCountInString(s) > o.MaxStringLength {
+				return fail(ErrStringTooLong, "contains a key longer than %d characters", o.MaxStringLength)
+			}
+			if o.DisallowDuplicateKeys {
+				folded := foldKey(s)
+				if _, seen := top.keys[folded]; seen {
+					return fail(ErrDuplicateKey, "contains duplicate key %q", s)
+				}
+				top.keys[folded] = struct{}{}
+			}
+			top.expectKey = false
+			continue
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		// tok is a value, of an object member or an array item
+		if top != nil {
+			if top.object {
+				top.expectKey = true
+			} else if top.items++; o.MaxArrayLength > 0 && top.items > o.MaxArrayLength {
+				return fail(ErrArrayTooLong, "contains an array with more than %d items", o.MaxArrayLength)
+			}
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			if o.MaxDepth > 0 && len(stack) >= o.MaxDepth {
+				return fail(ErrJSONTooDeep, "must not be nested more than %d levels deep", o.MaxDepth)
+			}
+			frame := &jsonFrame{object: v == '{', expectKey: v == '{'}
+			if frame.object && o.DisallowDuplicateKeys {
+				frame.keys = map[string]struct{}{}
+			}
+			stack = append(stack, frame)
+		case string:
+			if o.MaxStringLength > 0 && utf8.RuneCountInString(v) > o.MaxStringLength {
+				return fail(ErrStringTooLong, "contains a string longer than %d characters", o.MaxStringLength)
+			}
+		case json.Number:
+			if _, err := strconv.ParseFloat(v.String(), 64); o.RejectOverflowingNumbers && errors.Is(err, strconv.ErrRange) {
+				return fail(ErrNumberOverflow, "contains a number out of range")
+			}
+		}
+	}
+}
+
+// foldKey maps the keys encoding/json treats as the same field, which compares them with
+// Unicode case folding, to the same string
+func foldKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		// the smallest rune of the folding orbit stands for all of them, "K", "k" and the
+		// Kelvin sign all become "K"
+		smallest := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			smallest = min(smallest, f)
+		}
+		return smallest
+	}, key)
+}
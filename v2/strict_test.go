@@ -0,0 +1,78 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var strictJSONTests = []struct {
+	name          string
+	options       StrictJSONOptions
+	body          string
+	errorExpected string
+	kind          error
+}{
+	{name: "duplicate key", options: StrictJSONOptions{DisallowDuplicateKeys: true}, body: `{"role":"user","role":"admin"}`, errorExpected: `request body contains duplicate key "role" (at position 21)`, kind: ErrDuplicateKey},
+	{name: "duplicate key in another case", options: StrictJSONOptions{DisallowDuplicateKeys: true}, body: `{"role":"user","Role":"admin"}`, errorExpected: `request body contains duplicate key "Role" (at position 21)`, kind: ErrDuplicateKey},
+	{name: "nested duplicate key", options: StrictJSONOptions{DisallowDuplicateKeys: true}, body: `{"a":{"b":1},"c":[{"b":1,"b":2}]}`, errorExpected: `request body contains duplicate key "b" (at position 28)`, kind: ErrDuplicateKey},
+	{name: "same key in sibling objects", options: StrictJSONOptions{DisallowDuplicateKeys: true}, body: `{"a":{"b":1},"c":{"b":2},"d":[{"b":1},{"b":2}]}`},
+	{name: "too deep", options: StrictJSONOptions{MaxDepth: 3}, body: `{"a":[{"b":[1]}]}`, errorExpected: "request body must not be nested more than 3 levels deep (at position 12)", kind: ErrJSONTooDeep},
+	{name: "deep enough", options: StrictJSONOptions{MaxDepth: 3}, body: `{"a":[{"b":1}],"c":{"d":{}}}`},
+	{name: "array too long", options: StrictJSONOptions{MaxArrayLength: 2}, body: `{"a":[1,2],"b":[[1,2],[3],{}]}`, errorExpected: "request body contains an array with more than 2 items (at position 27)", kind: ErrArrayTooLong},
+	{name: "string too long", options: StrictJSONOptions{MaxStringLength: 4}, body: `{"name":"ğüşöç"}`, errorExpected: "request body contains a string longer than 4 characters (at position 20)", kind: ErrStringTooLong},
+	{name: "key too long", options: StrictJSONOptions{MaxStringLength: 4}, body: `{"longkey":"a"}`, errorExpected: "request body contains a key longer than 4 characters (at position 10)", kind: ErrStringTooLong},
+	{name: "overflowing number", options: StrictJSONOptions{RejectOverflowingNumbers: true}, body: `{"a":1e400}`, errorExpected: "request body contains a number out of range (at position 10)", kind: ErrNumberOverflow},
+	{name: "large number", options: StrictJSONOptions{RejectOverflowingNumbers: true}, body: `{"a":123456789012345678901234567890}`},
+	{name: "invalid utf-8", options: StrictJSONOptions{RejectInvalidUTF8: true}, body: "{\"a\":\"b\xffc\"}", errorExpected: "request body contains invalid UTF-8 (at position 7)", kind: ErrInvalidUTF8},
+	{name: "badly-formed json", options: StrictJSONOptions{DisallowDuplicateKeys: true}, body: `{"a":1,,"a":2}`, errorExpected: "request body contains badly-formed JSON (at position 8)"},
+	{name: "off", body: "{\"a\":1,\"a\":\"b\xffc\",\"c\":[[[[123456789012345678901234567890]]]]}"},
+}
+
+func TestTools_ReadJSONStrict(t *testing.T) {
+	for _, e := range strictJSONTests {
+		testTools := Tools{AllowUnknownFields: true, StrictJSON: e.options}
+		var data any
+		err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(e.body)), &data)
+		if e.errorExpected == "" {
+			if err != nil {
+				t.Errorf("%s: %v", e.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != e.errorExpected {
+			t.Errorf("%s: expected %q, got %v", e.name, e.errorExpected, err)
+			continue
+		}
+		if e.kind != nil && !errors.Is(err, e.kind) {
+			t.Errorf("%s: error does not wrap %v", e.name, e.kind)
+		}
+	}
+}
+
+func TestTools_ReadJSONUseNumber(t *testing.T) {
+	testTools := Tools{StrictJSON: StrictJSONOptions{UseNumber: true}}
+	var data struct {
+		ID    any     `json:"id"`
+		Price float64 `json:"price"`
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"id":9007199254740993,"price":1.5}`))
+	if err := testTools.ReadJSON(httptest.NewRecorder(), req, &data); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := data.ID.(json.Number); !ok || n.String() != "9007199254740993" || data.Price != 1.5 {
+		t.Errorf("numbers not decoded as expected: %#v", data)
+	}
+}
+
+func TestTools_ReadPatchStrict(t *testing.T) {
+	testTools := Tools{StrictJSON: StrictJSONOptions{DisallowDuplicateKeys: true}}
+	req := httptest.NewRequest("PATCH", "/profiles/7", strings.NewReader(`{"name":"a","name":"b"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	p := newProfile()
+	if err := testTools.ReadPatch(httptest.NewRecorder(), req, &p); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected a duplicate key error, got %v", err)
+	}
+}
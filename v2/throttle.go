@@ -0,0 +1,252 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrTooBusy is returned when a Throttle with LimitReject has no free transfer slot
+var ErrTooBusy = errors.New("server is too busy, try again later")
+
+// LimitPolicy decides what happens to a transfer when all slots of a Throttle are taken
+type LimitPolicy int
+
+const (
+	// LimitWait queues the transfer until a slot frees up or the request is cancelled
+	LimitWait LimitPolicy = iota
+	// LimitReject fails the transfer with ErrTooBusy, a 503 for handlers
+	LimitReject
+)
+
+// ThrottleOptions configures a Throttle, zero values mean unlimited
+type ThrottleOptions struct {
+	// BytesPerSecond caps the speed of every single transfer
+	BytesPerSecond int64
+	// GlobalBytesPerSecond caps the speed of all transfers together
+	GlobalBytesPerSecond int64
+	// MaxConcurrent caps the number of transfers running at the same time
+	MaxConcurrent int
+	// Policy applies once MaxConcurrent transfers are running
+	Policy LimitPolicy
+}
+
+// Throttle limits the bandwidth and concurrency of transfers. Set it as Tools.Throttle to
+// limit the copies of UploadFiles and resumable uploads and the bodies written by
+// DownloadStaticFile and DownloadZip. Multipart uploads are throttled while they are written
+// to the upload directory, after ParseMultipartForm has received them.
+type Throttle struct {
+	opts   ThrottleOptions
+	global *bucket
+	slots  chan struct{}
+	clock  throttleClock
+}
+
+// NewThrottle returns a Throttle for opts, share it between all Tools that should count
+// against the same global limits
+func NewThrottle(opts ThrottleOptions) *Throttle {
+	th := &Throttle{opts: opts, clock: realClock{}}
+	if opts.GlobalBytesPerSecond > 0 {
+		th.global = newBucket(opts.GlobalBytesPerSecond)
+	}
+	if opts.MaxConcurrent > 0 {
+		th.slots = make(chan struct{}, opts.MaxConcurrent)
+	}
+	return th
+}
+
+// throttleClock is time.Now and a sleep, replaced in tests so they do not have to wait
+type throttleClock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// bucket is a token bucket holding up to one second of bytes
+type bucket struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate int64) *bucket {
+	return &bucket{rate: rate, tokens: float64(rate)}
+}
+
+// take removes n tokens and returns how long to wait until they would have been available.
+// The bucket goes into debt, so concurrent transfers queue up behind each other fairly.
+func (b *bucket) take(now time.Time, n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+		if b.tokens > float64(b.rate) {
+			b.tokens = float64(b.rate)
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// acquire takes a transfer slot, the returned func gives it back. A nil Throttle never
+// limits anything.
+func (th *Throttle) acquire(ctx context.Context) (func(), error) {
+	if th == nil || th.slots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-th.slots }
+
+	if th.opts.Policy == LimitReject {
+		select {
+		case th.slots <- struct{}{}:
+			return release, nil
+		default:
+			return nil, ErrTooBusy
+		}
+	}
+	select {
+	case th.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// limiter is the bandwidth limit of one transfer, nil when the Throttle has none
+func (th *Throttle) limiter(ctx context.Context) *transferLimiter {
+	if th == nil || th.opts.BytesPerSecond <= 0 && th.global == nil {
+		return nil
+	}
+	l := &transferLimiter{ctx: ctx, clock: th.clock, global: th.global}
+	if th.opts.BytesPerSecond > 0 {
+		l.own = newBucket(th.opts.BytesPerSecond)
+	}
+	return l
+}
+
+// Reader wraps r so reading from it is limited, for copies the toolkit does not make itself
+func (th *Throttle) Reader(ctx context.Context, r io.Reader) io.Reader {
+	l := th.limiter(ctx)
+	if l == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: l}
+}
+
+// responseWriter wraps w so the body written to it is limited
+func (th *Throttle) responseWriter(ctx context.Context, w http.ResponseWriter) http.ResponseWriter {
+	l := th.limiter(ctx)
+	if l == nil {
+		return w
+	}
+	return &throttledWriter{ResponseWriter: w, limiter: l}
+}
+
+type transferLimiter struct {
+	ctx    context.Context
+	clock  throttleClock
+	own    *bucket
+	global *bucket
+}
+
+// chunk is the most bytes passed on at once, small enough to keep the rate smooth
+func (l *transferLimiter) chunk() int {
+	size := 32 * 1024
+	for _, b := range []*bucket{l.own, l.global} {
+		if b != nil && b.rate < int64(size) {
+			size = int(b.rate)
+		}
+	}
+	return size
+}
+
+// wait blocks until n bytes fit into both limits
+func (l *transferLimiter) wait(n int) error {
+	now := l.clock.Now()
+	var d time.Duration
+	for _, b := range []*bucket{l.own, l.global} {
+		if b == nil {
+			continue
+		}
+		if w := b.take(now, n); w > d {
+			d = w
+		}
+	}
+	if d <= 0 {
+		return l.ctx.Err()
+	}
+	return l.clock.Sleep(l.ctx, d)
+}
+
+type throttledReader struct {
+	r       io.Reader
+	limiter *transferLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.limiter.chunk() {
+		p = p[:t.limiter.chunk()]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.limiter.wait(n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type throttledWriter struct {
+	http.ResponseWriter
+	limiter *transferLimiter
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > t.limiter.chunk() {
+			n = t.limiter.chunk()
+		}
+		if err := t.limiter.wait(n); err != nil {
+			return written, err
+		}
+		n, err := t.ResponseWriter.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Flush passes on flushes, so streamed responses still reach the client in time
+func (t *throttledWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
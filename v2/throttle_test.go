@@ -0,0 +1,198 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock moves forward by the time slept instead of sleeping
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.slept += d
+	return ctx.Err()
+}
+
+func newTestThrottle(opts ThrottleOptions) (*Throttle, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	th := NewThrottle(opts)
+	th.clock = clock
+	return th, clock
+}
+
+var throttleTests = []struct {
+	name     string
+	opts     ThrottleOptions
+	size     int
+	expected time.Duration
+}{
+	{name: "unlimited", opts: ThrottleOptions{}, size: 100_000, expected: 0},
+	{name: "within the first second", opts: ThrottleOptions{BytesPerSecond: 10_000}, size: 10_000, expected: 0},
+	{name: "per request", opts: ThrottleOptions{BytesPerSecond: 10_000}, size: 50_000, expected: 4 * time.Second},
+	{name: "global", opts: ThrottleOptions{GlobalBytesPerSecond: 5_000}, size: 20_000, expected: 3 * time.Second},
+	{name: "slower limit wins", opts: ThrottleOptions{BytesPerSecond: 10_000, GlobalBytesPerSecond: 5_000}, size: 20_000, expected: 3 * time.Second},
+}
+
+func TestThrottle_Reader(t *testing.T) {
+	for _, e := range throttleTests {
+		th, clock := newTestThrottle(e.opts)
+
+		n, err := io.Copy(io.Discard, th.Reader(context.Background(), bytes.NewReader(make([]byte, e.size))))
+		if err != nil || n != int64(e.size) {
+			t.Errorf("%s: copy failed: %d, %v", e.name, n, err)
+		}
+		if diff := clock.slept - e.expected; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%s: slept %v, expected %v", e.name, clock.slept, e.expected)
+		}
+	}
+}
+
+func TestThrottle_GlobalIsShared(t *testing.T) {
+	th, clock := newTestThrottle(ThrottleOptions{GlobalBytesPerSecond: 1000})
+
+	// two transfers of 1500 bytes share 1000 bytes per second, so together they take 3s
+	for i := 0; i < 2; i++ {
+		if _, err := io.Copy(io.Discard, th.Reader(context.Background(), bytes.NewReader(make([]byte, 1500)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if clock.slept != 2*time.Second {
+		t.Errorf("slept %v, expected 2s", clock.slept)
+	}
+}
+
+func TestThrottle_CancelledTransfer(t *testing.T) {
+	th, _ := newTestThrottle(ThrottleOptions{BytesPerSecond: 100})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := io.Copy(io.Discard, th.Reader(ctx, bytes.NewReader(make([]byte, 1000))))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the copy to stop, got %v", err)
+	}
+}
+
+func TestThrottle_Concurrency(t *testing.T) {
+	th, _ := newTestThrottle(ThrottleOptions{MaxConcurrent: 1, Policy: LimitReject})
+	release, err := th.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := th.acquire(context.Background()); !errors.Is(err, ErrTooBusy) {
+		t.Errorf("expected ErrTooBusy, got %v", err)
+	}
+	release()
+	if _, err := th.acquire(context.Background()); err != nil {
+		t.Errorf("slot not released: %v", err)
+	}
+
+	th, _ = newTestThrottle(ThrottleOptions{MaxConcurrent: 1, Policy: LimitWait})
+	release, _ = th.acquire(context.Background())
+	acquired := make(chan error)
+	go func() {
+		_, err := th.acquire(context.Background())
+		acquired <- err
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second transfer did not wait")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("waiting transfer failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := th.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled wait, got %v", err)
+	}
+}
+
+func TestTools_DownloadStaticFileThrottled(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(p, make([]byte, 30_000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var testTools Tools
+	var clock *fakeClock
+	testTools.Throttle, clock = newTestThrottle(ThrottleOptions{BytesPerSecond: 10_000, MaxConcurrent: 1, Policy: LimitReject})
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), p, "big.bin")
+	if rr.Code != http.StatusOK || rr.Body.Len() != 30_000 {
+		t.Fatalf("download not as expected: %d, %d bytes", rr.Code, rr.Body.Len())
+	}
+	if clock.slept != 2*time.Second {
+		t.Errorf("slept %v, expected 2s", clock.slept)
+	}
+
+	release, _ := testTools.Throttle.acquire(context.Background())
+	defer release()
+	rr = httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), p, "big.bin")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a free slot, got %d", rr.Code)
+	}
+}
+
+func TestTools_UploadFilesThrottled(t *testing.T) {
+	var testTools Tools
+	var clock *fakeClock
+	testTools.Throttle, clock = newTestThrottle(ThrottleOptions{BytesPerSecond: 1000, MaxConcurrent: 1, Policy: LimitReject})
+
+	content := bytes.Repeat([]byte("text "), 600)
+	if _, err := testTools.UploadFiles(multipartRequest(t, "a.txt", content), t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if clock.slept != 2*time.Second {
+		t.Errorf("slept %v, expected 2s", clock.slept)
+	}
+
+	release, _ := testTools.Throttle.acquire(context.Background())
+	defer release()
+	_, err := testTools.UploadFiles(multipartRequest(t, "a.txt", content), t.TempDir())
+	if !errors.Is(err, ErrTooBusy) {
+		t.Fatalf("expected ErrTooBusy, got %v", err)
+	}
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, err)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", rr.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	testTools.Throttle, _ = newTestThrottle(ThrottleOptions{MaxConcurrent: 1})
+	release, _ = testTools.Throttle.acquire(context.Background())
+	defer release()
+	_, err = testTools.UploadFiles(multipartRequest(t, "a.txt", content).WithContext(ctx), t.TempDir())
+	var statusErr *StatusError
+	if !errors.Is(err, context.Canceled) || !errors.As(err, &statusErr) || statusErr.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 wrapping context.Canceled, got %v", err)
+	}
+}
@@ -2,16 +2,16 @@ package toolkit
 
 import (
 	"bytes"
-	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"time"
 )
 
 const ALPHABET = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_+"
@@ -22,18 +22,39 @@ type Tools struct {
 	AllowedFileTypes   []string
 	MaxJSONSize        int64
 	AllowUnknownFields bool
+	// MaxFormSize caps form bodies read by ReadForm, Bind and BindForm, defaults to one megabyte
+	MaxFormSize int64
+	// Scanner, when set, checks every uploaded file before it is moved out of QuarantineDir
+	Scanner Scanner
+	// QuarantineDir holds uploads awaiting a scan, defaults to .quarantine inside the upload directory
+	QuarantineDir string
+	// NamingStrategy names renamed uploads, defaults to NameRandom
+	NamingStrategy NamingStrategy
+	// SanitizeFileNames makes uploads that are not renamed safe with SanitizeFilename
+	SanitizeFileNames bool
+	FilenameOptions   FilenameOptions
+	// DirMode is the mode of directories created by CreateDirIfNotExists, defaults to 0755
+	// narrowed by the process umask
+	DirMode os.FileMode
+	// Throttle limits the bandwidth and concurrency of uploads and downloads
+	Throttle *Throttle
+	// Logger is used by the middleware, defaults to slog.Default()
+	Logger *slog.Logger
+	// StrictJSON makes ReadJSON reject duplicate keys, deep nesting, long arrays and strings,
+	// overflowing numbers and invalid UTF-8
+	StrictJSON StrictJSONOptions
+
+	now func() time.Time
 }
 
-// RandomString generates a random string with given length
-func (t *Tools) RandomString(length int) string {
-	s, r := make([]rune, length), []rune(ALPHABET)
-	for i := range s {
-		p, _ := rand.Prime(rand.Reader, len(r))
-		x, y := p.Uint64(), uint64(len(r))
-		s[i] = r[x%y]
-
+// RandomString generates a random string with given length, drawn uniformly from ALPHABET or
+// from the alphabet passed in, e.g. AlphabetHex or AlphabetCrockford
+func (t *Tools) RandomString(length int, alphabet ...string) string {
+	r := []rune(ALPHABET)
+	if len(alphabet) > 0 && alphabet[0] != "" {
+		r = []rune(alphabet[0])
 	}
-	return string(s)
+	return randomFrom(r, length)
 }
 
 // UploadedFile is a struct for uploaded file
@@ -59,6 +80,15 @@ func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool)
 }
 
 func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
+	return t.UploadFilesWithForm(r, uploadDir, nil, rename...)
+}
+
+// UploadFilesWithForm is UploadFiles that also decodes the other fields of the multipart form
+// into the struct form points to, using `form:"name"` tags as Bind does, and validates it when
+// it implements Validator. Files are only stored once the form is valid. A nil form skips the
+// fields. Without a free Throttle slot the error is a StatusError with a 503 wrapping ErrTooBusy
+// or the context error.
+func (t *Tools) UploadFilesWithForm(r *http.Request, uploadDir string, form any, rename ...bool) ([]*UploadedFile, error) {
 	renameFile := true
 	if len(rename) > 0 {
 		renameFile = rename[0]
@@ -69,7 +99,13 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 		t.MaxFileSize = 1024 * 1024 * 1024
 	}
 
-	err := t.CreateDirIfNotExists(uploadDir)
+	release, err := t.Throttle.acquire(r.Context())
+	if err != nil {
+		return nil, WithStatus(err, http.StatusServiceUnavailable)
+	}
+	defer release()
+
+	err = t.CreateDirIfNotExists(uploadDir)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +115,17 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 		return nil, errors.New("the uploaded file is too big")
 	}
 
+	if form != nil {
+		if err := bindValues(form, postFormSource(r)); err != nil {
+			return nil, err
+		}
+		if v, ok := form.(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	for _, fHeaders := range r.MultipartForm.File {
 		for _, hdr := range fHeaders {
 			uploadedFiles, err = func(uploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
@@ -96,18 +143,7 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 				}
 
 				// check to see if the file type is permitted
-				allowed := false
-				fileType := http.DetectContentType(buff)
-				if len(t.AllowedFileTypes) > 0 {
-					for _, x := range t.AllowedFileTypes {
-						if strings.EqualFold(fileType, x) {
-							allowed = true
-						}
-					}
-				} else {
-					allowed = true
-				}
-				if !allowed {
+				if !t.isAllowedFileType(http.DetectContentType(buff)) {
 					return nil, errors.New("file type is not allowed")
 				}
 
@@ -117,22 +153,38 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 				}
 
 				if renameFile {
-					uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
+					uploadedFile.NewFileName = t.newFileName(hdr.Filename)
 				} else {
-					uploadedFile.NewFileName = hdr.Filename
+					uploadedFile.NewFileName, err = t.keepFileName(hdr.Filename)
+					if err != nil {
+						return nil, err
+					}
+				}
+				// with a scanner configured files sit in quarantine until they pass
+				storeDir := uploadDir
+				if t.Scanner != nil {
+					storeDir = t.quarantineDir(uploadDir)
+					if err := t.CreateDirIfNotExists(storeDir); err != nil {
+						return nil, err
+					}
 				}
-				var outfile *os.File
-				defer outfile.Close()
 
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadedFile.NewFileName)); err != nil {
+				// written to a temporary file first, a failed copy never leaves half a file behind
+				target := filepath.Join(storeDir, uploadedFile.NewFileName)
+				if err := t.createParentDir(target); err != nil {
 					return nil, err
-				} else {
-					fileSize, err := io.Copy(outfile, infile)
+				}
+				fileSize, err := t.AtomicWriteFromReader(target, t.Throttle.Reader(r.Context(), infile), 0644)
+				if err != nil {
+					return nil, err
+				}
+				uploadedFile.FileSize = fileSize
+
+				if t.Scanner != nil {
+					err = t.releaseFromQuarantine(r.Context(), storeDir, uploadDir, uploadedFile.NewFileName)
 					if err != nil {
 						return nil, err
 					}
-					uploadedFile.FileSize = fileSize
-
 				}
 				uploadedFile.OriginalFileName = hdr.Filename
 				uploadedFiles = append(uploadedFiles, &uploadedFile)
@@ -146,37 +198,44 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 	return uploadedFiles, nil
 }
 
-// create dir if not exists!! and parents if not exists
-func (t *Tools) CreateDirIfNotExists(path string) error {
-	const mode = 0755
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := os.MkdirAll(path, mode)
-		if err != nil {
-			return err
+// isAllowedFileType reports whether the detected content type is permitted by AllowedFileTypes,
+// an empty list permits everything
+func (t *Tools) isAllowedFileType(fileType string) bool {
+	if len(t.AllowedFileTypes) == 0 {
+		return true
+	}
+	for _, x := range t.AllowedFileTypes {
+		if strings.EqualFold(fileType, x) {
+			return true
 		}
 	}
-	return nil
+	return false
+}
+
+// create dir if not exists!! and parents if not exists, with DirMode or 0755 and the umask
+func (t *Tools) CreateDirIfNotExists(path string) error {
+	_, err := t.CreateDir(path, DirOptions{Mode: t.DirMode})
+	return err
 }
 
 // gets a original string making it slug -> "this is a slug" -> "this-is-a-slug"
 func (t *Tools) Slugify(s string) (string, error) {
-	if s == "" {
-		return "", errors.New("string is empty")
-	}
-	var re = regexp.MustCompile(`[^a-z\d]+`)
-	slug := strings.Trim(re.ReplaceAllString(strings.ToLower(s), "-"), "-")
-	if len(slug) == 0 {
-		return "", errors.New("slug is empty")
-	}
-	return slug, nil
+	return t.SlugifyWith(s, SlugOptions{})
 }
 
 // it downloads a file and tries to force the browser to avoid displaying it
 // in the browser window by setting content disposition to attachment, it allows spesification
 // of the display name
 func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, pathName, displayName string) {
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
-	http.ServeFile(w, r, pathName)
+	release, err := t.Throttle.acquire(r.Context())
+	if err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Disposition", contentDisposition(displayName))
+	http.ServeFile(t.Throttle.responseWriter(r.Context(), w), r, pathName)
 }
 
 // JSON response is the type used for sending json around
@@ -186,24 +245,50 @@ type JSONResponse struct {
 	Data    any    `json:"data"`
 }
 
+// errEmptyBody is returned by ReadJSON for a body without any JSON
+var errEmptyBody = errors.New("request body must not be empty")
+
 // ReadjSON tries to read the body of a req and converts from json intoa a go data var.
-func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data any) error {
+// With a schema the body is validated against it before decoding, a mismatch is returned as
+// a SchemaError listing all violations. A body over MaxJSONSize is a StatusError with a 413.
+func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data any, schema ...*Schema) error {
 	maxBytes := 1024 * 1024 // default one megabytes
 
 	if t.MaxJSONSize > 0 {
 		maxBytes = int(t.MaxJSONSize)
 	}
+	hasSchema := len(schema) > 0 && schema[0] != nil
+	if hasSchema || t.StrictJSON.enabled() {
+		body, err := t.readJSONBody(w, r)
+		if err != nil {
+			return err
+		}
+		if err := t.StrictJSON.check(body); err != nil {
+			return err
+		}
+		// badly-formed bodies are left to the decoder below, which describes the problem
+		if v, err := decodeJSONValue(body); hasSchema && err == nil {
+			if err := schema[0].validate(v); err != nil {
+				return err
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 	dec := json.NewDecoder(r.Body)
 
 	if !t.AllowUnknownFields {
 		dec.DisallowUnknownFields()
 	}
+	if t.StrictJSON.UseNumber {
+		dec.UseNumber()
+	}
 	err := dec.Decode(data)
 	if err != nil {
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
 
 		switch {
 		case errors.As(err, &syntaxError):
@@ -216,14 +301,14 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data any) error
 			}
 			return fmt.Errorf("request body contains an invalid value (at position %d)", unmarshalTypeError.Offset)
 		case errors.Is(err, io.EOF):
-			return errors.New("request body must not be empty")
+			return errEmptyBody
 		case errors.As(err, &invalidUnmarshalError):
 			return fmt.Errorf("unmarshalling json")
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			return fmt.Errorf("request body contains unknown field %s", fieldName)
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("request body must not be larger than %d bytes", maxBytes)
+		case errors.As(err, &maxBytesError):
+			return WithStatus(fmt.Errorf("request body must not be larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
 
 		default:
 			return err
@@ -237,6 +322,26 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data any) error
 	return nil
 }
 
+// readJSONBody reads the whole request body with the size limit of ReadJSON
+func (t *Tools) readJSONBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := int64(1024 * 1024) // default one megabyte
+	if t.MaxJSONSize > 0 {
+		maxBytes = t.MaxJSONSize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, WithStatus(fmt.Errorf("request body must not be larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		}
+		return nil, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, errEmptyBody
+	}
+	return body, nil
+}
+
 // take a response status code and arbitrary data and write it to the response writer as json
 func (t *Tools) WriteJSON(w http.ResponseWriter, data any, status int, headers ...http.Header) error {
 	out, err := json.Marshal(data)
@@ -257,12 +362,16 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, data any, status int, headers .
 	return err
 }
 
-// takes an error and optionally status code and send json response with error
+// takes an error and optionally status code and send json response with error, without a
+// status code the status of a StatusError is used, 400 otherwise
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
 	statusCode := http.StatusBadRequest
 
+	var statusErr *StatusError
 	if len(status) > 0 {
 		statusCode = status[0]
+	} else if errors.As(err, &statusErr) {
+		statusCode = statusErr.Status
 	}
 
 	var payload JSONResponse
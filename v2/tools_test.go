@@ -208,7 +208,7 @@ var slugTests = []struct {
 	{name: "valid string", s: "This is a valid string", expected: "this-is-a-valid-string", errorExpected: false},
 	{name: "empty string", s: "", expected: "", errorExpected: true},
 	{name: "string with numbers", s: "This is a valid string 123", expected: "this-is-a-valid-string-123", errorExpected: false},
-	{name: "string with characters", s: "Th*İSs *eĞcspeCtDe!", expected: "th-iss-e-cspectde", errorExpected: false},
+	{name: "string with characters", s: "Th*İSs *eĞcspeCtDe!", expected: "th-iss-egcspectde", errorExpected: false},
 	{name: "japanese string", s: "これは日本語の文字列です", expected: "", errorExpected: true},
 	{name: "japanese chars with roman characters", s: "これは日本語の文字列ですhello world", expected: "hello-world", errorExpected: true},
 }